@@ -0,0 +1,210 @@
+// Package cli runs flint-ls' language configuration from the command line, so
+// that CI and pre-commit hooks check a project with exactly the tools and
+// settings its editors use.
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// Exit codes shared by the subcommands. Findings and failures are kept apart so
+// that CI can tell a project that needs fixing from a setup that does.
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitFailure  = 2
+)
+
+// defaultConfigFile is read when no --config is given.
+const defaultConfigFile = ".flint-ls.json"
+
+// commonFlags are the flags every subcommand that works on files takes.
+type commonFlags struct {
+	config   string
+	language string
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.config, "config", defaultConfigFile,
+		"JSON file holding the settings a client would send in didChangeConfiguration")
+	fs.StringVar(&c.language, "language", "",
+		"language ID of every file given, instead of guessing it from the file's name")
+}
+
+// loadConfig reads a config file, which holds the same settings a client sends
+// in workspace/didChangeConfiguration. Unknown keys are an error: a typo in a
+// setting the editor silently ignores is exactly what a check run should catch.
+func loadConfig(path string) (*types.Config, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+
+	var config types.Config
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(config.Languages) == 0 {
+		return nil, fmt.Errorf("%s: no languages configured", path)
+	}
+
+	return &config, nil
+}
+
+// newLangHandler sets up a handler the way a client would: configured, and
+// rooted at the working directory.
+func newLangHandler(config *types.Config) (*core.LangHandler, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	h := core.NewHandler(config.Languages)
+	h.UpdateConfiguration(config)
+	if _, err := h.Initialize(types.InitializeParams{RootURI: core.ParseLocalFileToURI(cwd)}); err != nil {
+		h.Close()
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// languageIDsByExtension maps file extensions to the language IDs editors use
+// for them, where the two differ or the extension is ambiguous. Anything else
+// goes by its extension.
+var languageIDsByExtension = map[string]string{
+	".bash": "sh",
+	".cjs":  "javascript",
+	".cc":   "cpp",
+	".cpp":  "cpp",
+	".cs":   "csharp",
+	".h":    "c",
+	".hpp":  "cpp",
+	".js":   "javascript",
+	".jsx":  "javascriptreact",
+	".md":   "markdown",
+	".mjs":  "javascript",
+	".py":   "python",
+	".rb":   "ruby",
+	".rs":   "rust",
+	".tf":   "terraform",
+	".ts":   "typescript",
+	".tsx":  "typescriptreact",
+	".yml":  "yaml",
+	".zsh":  "zsh",
+}
+
+// languageIDsByName is languageIDsByExtension for files known by their name.
+var languageIDsByName = map[string]string{
+	"Dockerfile":     "dockerfile",
+	"GNUmakefile":    "make",
+	"Makefile":       "make",
+	"CMakeLists.txt": "cmake",
+}
+
+// languageID guesses the language ID an editor would give path.
+func languageID(path string) string {
+	base := filepath.Base(path)
+	if id, ok := languageIDsByName[base]; ok {
+		return id
+	}
+
+	ext := strings.ToLower(filepath.Ext(base))
+	if id, ok := languageIDsByExtension[ext]; ok {
+		return id
+	}
+	return strings.TrimPrefix(ext, ".")
+}
+
+// document is a file to run the tools on.
+type document struct {
+	path       string
+	languageID string
+}
+
+// collectDocuments expands paths into the documents to work on. A file named
+// explicitly is always included. A directory is walked, skipping hidden
+// directories, for the files whose language has a config of its own: the
+// wildcard config alone would otherwise take in every binary and lockfile in
+// the tree.
+func collectDocuments(paths []string, language string, configs map[string][]types.Language) ([]document, error) {
+	languageOf := func(path string) string {
+		if language != "" {
+			return language
+		}
+		return languageID(path)
+	}
+
+	var documents []document
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			documents = append(documents, document{path: path, languageID: languageOf(path)})
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if p != path && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			id := languageOf(p)
+			if _, ok := configs[id]; ok || language != "" {
+				documents = append(documents, document{path: p, languageID: id})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return documents, nil
+}
+
+// newFlagSet returns a flag set that reports its own errors to stderr and
+// leaves exiting to the caller.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags parses args, and returns the exit code to end with when that is all
+// the subcommand is going to do.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK, false
+	case err != nil:
+		return exitFailure, false
+	default:
+		return exitOK, true
+	}
+}
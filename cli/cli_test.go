@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestLanguageID(t *testing.T) {
+	tests := map[string]string{
+		"main.go":           "go",
+		"script.py":         "python",
+		"dir/App.TSX":       "typescriptreact",
+		"Dockerfile":        "dockerfile",
+		"sub/Makefile":      "make",
+		"notes.unheardof":   "unheardof",
+		"no-extension-here": "",
+	}
+
+	for path, want := range tests {
+		assert.Equal(t, want, languageID(path), path)
+	}
+}
+
+func TestLoadConfigRejectsUnknownSettings(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeConfig(t, dir, map[string]any{"languages": map[string]any{"go": []any{map[string]any{"lintComand": "x"}}}})
+	_, err := loadConfig(path)
+	assert.ErrorContains(t, err, "lintComand", "a misspelt setting is what a check run should catch")
+
+	path = writeConfig(t, dir, map[string]any{"lintDebounce": 1})
+	_, err = loadConfig(path)
+	assert.ErrorContains(t, err, "no languages configured")
+}
+
+func TestCollectDocuments(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.txt", "sub/c.go", ".git/d.go"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+	configs := map[string][]types.Language{
+		"go":           {{LintCommand: "true"}},
+		types.Wildcard: {{LintCommand: "true"}},
+	}
+
+	got, err := collectDocuments([]string{dir, filepath.Join(dir, "b.txt")}, "", configs)
+	require.NoError(t, err)
+	assert.Equal(t, []document{
+		{path: filepath.Join(dir, "a.go"), languageID: "go"},
+		{path: filepath.Join(dir, "sub", "c.go"), languageID: "go"},
+		// named explicitly, so included whether or not its language has a config
+		{path: filepath.Join(dir, "b.txt"), languageID: "txt"},
+	}, got)
+
+	got, err = collectDocuments([]string{filepath.Join(dir, "sub")}, "golang", configs)
+	require.NoError(t, err)
+	assert.Equal(t, []document{{path: filepath.Join(dir, "sub", "c.go"), languageID: "golang"}}, got,
+		"--language names the language of every file")
+}
+
+// writeConfig writes config as the JSON file flint-ls reads it from.
+func writeConfig(t *testing.T, dir string, config any) string {
+	t.Helper()
+
+	body, err := json.Marshal(config)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "flint-ls.json")
+	require.NoError(t, os.WriteFile(path, body, 0o600))
+
+	return path
+}
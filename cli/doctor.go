@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// Doctor is `flint-ls doctor`: it explains what flint-ls makes of a file -- which
+// configs apply to it and why the others do not, the commands their tools run
+// as, and what those tools made of the file in a dry run.
+func Doctor(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("doctor", stderr)
+	var common commonFlags
+	common.register(fs)
+	format := fs.String("format", "human", "how to print the diagnosis: human or json")
+	tabSize := fs.Int("tab-size", 4, "the tabSize formatting option the formatters' dry run gets")
+	useTabs := fs.Bool("use-tabs", false, "unset the insertSpaces formatting option the formatters' dry run gets")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: flint-ls doctor [flags] FILE")
+		fs.PrintDefaults()
+	}
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitFailure
+	}
+	if *format != "human" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return exitFailure
+	}
+
+	config, err := loadConfig(common.config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	h, err := newLangHandler(config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	defer h.Close()
+
+	language := common.language
+	if language == "" {
+		language = languageID(fs.Arg(0))
+	}
+	options := types.FormattingOptions{"tabSize": *tabSize, "insertSpaces": !*useTabs}
+
+	diagnosis, err := diagnose(ctx, h, fs.Arg(0), language, options)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diagnosis)
+	} else {
+		_, err = fmt.Fprint(stdout, diagnosis.Report())
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	if diagnosis.Failed() {
+		return exitFindings
+	}
+	return exitOK
+}
+
+func diagnose(ctx context.Context, h *core.LangHandler, path, language string, options types.FormattingOptions) (core.Diagnosis, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return core.Diagnosis{}, err
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return core.Diagnosis{}, err
+	}
+
+	uri := core.ParseLocalFileToURI(path)
+	if err := h.OpenFile(uri, language, 1, string(text)); err != nil {
+		return core.Diagnosis{}, err
+	}
+	defer h.CloseFile(uri)
+
+	return h.Diagnose(ctx, uri, options)
+}
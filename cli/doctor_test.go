@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/core"
+)
+
+func runDoctor(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	code = Doctor(t.Context(), args, &out, &errOut)
+
+	return code, out.String(), errOut.String()
+}
+
+func TestDoctor(t *testing.T) {
+	config := newLintProject(t, nil)
+
+	code, stdout, stderr := runDoctor(t, "--config", config, "main.go")
+
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stderr)
+	assert.Contains(t, stdout, "language:  go\n")
+	assert.Contains(t, stdout, "command:     echo 1:9:no doc comment\n")
+	assert.Contains(t, stdout, "      | 1:9:no doc comment\n")
+	assert.Contains(t, stdout, "diagnostics: 1\n")
+}
+
+func TestDoctorJSON(t *testing.T) {
+	config := newLintProject(t, map[string]any{"lintCommand": "echo cannot run >&2; exit 127"})
+
+	code, stdout, _ := runDoctor(t, "--config", config, "--format", "json", "main.go")
+
+	assert.Equal(t, exitFindings, code, "a tool that failed its dry run is what the doctor is there to find")
+
+	var got core.Diagnosis
+	require.NoError(t, json.Unmarshal([]byte(stdout), &got))
+	require.Len(t, got.Configs, 1)
+	require.NotNil(t, got.Configs[0].Linter)
+	assert.Contains(t, got.Configs[0].Linter.Error, "cannot run")
+}
+
+func TestDoctorTakesOneFile(t *testing.T) {
+	config := newLintProject(t, nil)
+
+	code, _, _ := runDoctor(t, "--config", config, "main.go", "main.go")
+
+	assert.Equal(t, exitFailure, code)
+}
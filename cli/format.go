@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/aymanbagabas/go-udiff"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// Format is `flint-ls format`: it formats the files it is given with the
+// formatters their languages are configured with, combined the way their format
+// mode says, and writes the results back. With --check or --diff it leaves the
+// files alone and prints what it would have changed instead.
+func Format(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("format", stderr)
+	var common commonFlags
+	common.register(fs)
+	check := fs.Bool("check", false,
+		"write nothing, print a diff of the files that are not formatted and fail if there are any")
+	diff := fs.Bool("diff", false, "write nothing and print a diff of the files that are not formatted")
+	tabSize := fs.Int("tab-size", 4, "the tabSize formatting option, as an editor would send it")
+	useTabs := fs.Bool("use-tabs", false, "unset the insertSpaces formatting option, as an editor would")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: flint-ls format [flags] PATH...")
+		fs.PrintDefaults()
+	}
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitFailure
+	}
+
+	config, err := loadConfig(common.config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	documents, err := collectDocuments(fs.Args(), common.language, config.Languages)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	h, err := newLangHandler(config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	defer h.Close()
+
+	options := types.FormattingOptions{"tabSize": *tabSize, "insertSpaces": !*useTabs}
+	results := formatDocuments(ctx, h, documents, options)
+
+	code := exitOK
+	for _, result := range results {
+		for _, warning := range result.warnings {
+			fmt.Fprintf(stderr, "%s: warning: %s\n", result.path, warning)
+		}
+		if result.err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", result.path, result.err)
+			code = exitFailure
+			continue
+		}
+		if result.before == result.after {
+			continue
+		}
+
+		if *check || *diff {
+			fmt.Fprint(stdout, udiff.Unified(result.path, result.path, result.before, result.after))
+			if *check && code == exitOK {
+				code = exitFindings
+			}
+			continue
+		}
+
+		// writing over the file rather than replacing it keeps its mode, its owner
+		// and any links to it
+		if err := os.WriteFile(result.path, []byte(result.after), 0o666); err != nil {
+			fmt.Fprintln(stderr, err)
+			code = exitFailure
+		}
+	}
+
+	return code
+}
+
+// formatResult is what formatting one file came to.
+type formatResult struct {
+	path     string
+	before   string
+	after    string
+	warnings []string
+	err      error
+}
+
+// formatDocuments formats documents in parallel, one per CPU at a time, and
+// returns the results in the order the documents were given in.
+func formatDocuments(ctx context.Context, h *core.LangHandler, documents []document, options types.FormattingOptions) []formatResult {
+	results := make([]formatResult, len(documents))
+	slots := make(chan struct{}, runtime.NumCPU())
+
+	var wg sync.WaitGroup
+	for i, doc := range documents {
+		wg.Go(func() {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i] = formatDocument(ctx, h, doc, options)
+		})
+	}
+	wg.Wait()
+
+	return results
+}
+
+func formatDocument(ctx context.Context, h *core.LangHandler, doc document, options types.FormattingOptions) formatResult {
+	result := formatResult{path: doc.path}
+
+	path, err := filepath.Abs(doc.path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.before = string(text)
+	result.after = result.before
+
+	uri := core.ParseLocalFileToURI(path)
+	if err := h.OpenFile(uri, doc.languageID, 1, result.before); err != nil {
+		result.err = err
+		return result
+	}
+	defer h.CloseFile(uri)
+
+	reporter := &collectingReporter{uri: uri}
+	edits, err := h.RunAllFormatters(ctx, reporter, uri, nil, options)
+	result.warnings = reporter.warnings
+	if err = errors.Join(append(reporter.errors, err)...); err != nil {
+		result.err = err
+		return result
+	}
+
+	result.after, result.err = core.ApplyEdits(result.before, edits)
+	return result
+}
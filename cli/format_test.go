@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFormatProject makes a project with one text file and a config that
+// upper-cases it, and makes it the working directory.
+func newFormatProject(t *testing.T, formatters ...map[string]any) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatters below are POSIX tools")
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello\nworld\n"), 0o640))
+
+	if len(formatters) == 0 {
+		formatters = []map[string]any{{"formatArgs": []string{"tr", "a-z", "A-Z"}}}
+	}
+	configs := make([]any, len(formatters))
+	for i, f := range formatters {
+		configs[i] = f
+	}
+
+	return writeConfig(t, dir, map[string]any{"languages": map[string]any{"txt": configs}})
+}
+
+func runFormat(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	code = Format(t.Context(), args, &out, &errOut)
+
+	return code, out.String(), errOut.String()
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	body, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestFormatWritesInPlace(t *testing.T) {
+	config := newFormatProject(t)
+
+	code, stdout, stderr := runFormat(t, "--config", config, ".")
+
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stdout)
+	assert.Empty(t, stderr)
+	assert.Equal(t, "HELLO\nWORLD\n", readFile(t, "a.txt"))
+
+	info, err := os.Stat("a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm(), "formatting a file must not change who may read it")
+}
+
+func TestFormatChainsFormatters(t *testing.T) {
+	config := newFormatProject(t,
+		map[string]any{"formatArgs": []string{"tr", "a-z", "A-Z"}},
+		map[string]any{"formatArgs": []string{"tr", "O", "0"}},
+	)
+
+	code, _, _ := runFormat(t, "--config", config, "a.txt")
+
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "HELL0\nW0RLD\n", readFile(t, "a.txt"))
+}
+
+func TestFormatCheck(t *testing.T) {
+	config := newFormatProject(t)
+
+	code, stdout, _ := runFormat(t, "--config", config, "--check", "a.txt")
+
+	assert.Equal(t, exitFindings, code)
+	assert.Equal(t, "--- a.txt\n+++ a.txt\n@@ -1,2 +1,2 @@\n-hello\n-world\n+HELLO\n+WORLD\n", stdout)
+	assert.Equal(t, "hello\nworld\n", readFile(t, "a.txt"), "a check must not write")
+
+	// and once formatted, there is nothing left to check
+	code, _, _ = runFormat(t, "--config", config, "a.txt")
+	require.Equal(t, exitOK, code)
+	code, stdout, _ = runFormat(t, "--config", config, "--check", "a.txt")
+	assert.Equal(t, exitOK, code)
+	assert.Empty(t, stdout)
+}
+
+func TestFormatDiff(t *testing.T) {
+	config := newFormatProject(t)
+
+	code, stdout, _ := runFormat(t, "--config", config, "--diff", "a.txt")
+
+	assert.Equal(t, exitOK, code, "a diff alone is not a check")
+	assert.Contains(t, stdout, "+HELLO\n")
+	assert.Equal(t, "hello\nworld\n", readFile(t, "a.txt"))
+}
+
+func TestFormatReportsFormattersThatFail(t *testing.T) {
+	config := newFormatProject(t, map[string]any{"formatCommand": "echo broken >&2; exit 1"})
+
+	code, _, stderr := runFormat(t, "--config", config, "a.txt")
+
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "a.txt: ")
+	assert.Equal(t, "hello\nworld\n", readFile(t, "a.txt"))
+}
@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// allEvents makes every linter run that lints on any event at all. On the
+// command line there is no open, change or save to tell them apart by.
+const allEvents = types.EventTypeOpen | types.EventTypeChange | types.EventTypeSave
+
+// Lint is `flint-ls lint`: it lints the files it is given with the linters their
+// languages are configured with, prints what those found, and returns the exit
+// code to end with.
+func Lint(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("lint", stderr)
+	var common commonFlags
+	common.register(fs)
+	format := fs.String("format", "human", "how to print diagnostics: human, json or github")
+	failOn := fs.String("fail-on", "error",
+		"least severe diagnostic that fails the run: error, warning, information, hint or never")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: flint-ls lint [flags] PATH...")
+		fs.PrintDefaults()
+	}
+
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitFailure
+	}
+
+	printDiagnostics, ok := diagnosticPrinters[*format]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return exitFailure
+	}
+	threshold, ok := parseSeverity(*failOn)
+	if !ok {
+		fmt.Fprintf(stderr, "unknown severity %q\n", *failOn)
+		return exitFailure
+	}
+
+	config, err := loadConfig(common.config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	documents, err := collectDocuments(fs.Args(), common.language, config.Languages)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	h, err := newLangHandler(config)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	defer h.Close()
+
+	results := lintDocuments(ctx, h, documents)
+
+	code := exitOK
+	for _, result := range results {
+		for _, warning := range result.warnings {
+			fmt.Fprintf(stderr, "%s: warning: %s\n", result.path, warning)
+		}
+		if result.err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", result.path, result.err)
+			code = exitFailure
+		}
+		if code == exitOK && failsAt(result.diagnostics, threshold) {
+			code = exitFindings
+		}
+	}
+
+	if err := printDiagnostics(stdout, results); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	return code
+}
+
+// lintResult is what linting one file came to.
+type lintResult struct {
+	path        string
+	diagnostics []types.Diagnostic
+	warnings    []string
+	err         error
+}
+
+// lintDocuments lints documents in parallel, one per CPU at a time since every
+// one of them starts processes of its own, and returns the results in the order
+// the documents were given in.
+func lintDocuments(ctx context.Context, h *core.LangHandler, documents []document) []lintResult {
+	results := make([]lintResult, len(documents))
+	slots := make(chan struct{}, runtime.NumCPU())
+
+	var wg sync.WaitGroup
+	for i, doc := range documents {
+		wg.Go(func() {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			results[i] = lintDocument(ctx, h, doc)
+		})
+	}
+	wg.Wait()
+
+	return results
+}
+
+func lintDocument(ctx context.Context, h *core.LangHandler, doc document) lintResult {
+	result := lintResult{path: doc.path}
+
+	path, err := filepath.Abs(doc.path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	uri := core.ParseLocalFileToURI(path)
+	if err := h.OpenFile(uri, doc.languageID, 1, string(text)); err != nil {
+		result.err = err
+		return result
+	}
+	defer h.CloseFile(uri)
+
+	reporter := &collectingReporter{uri: uri}
+	err = h.RunAllLinters(ctx, reporter, uri, allEvents)
+
+	result.diagnostics = reporter.diagnostics
+	result.warnings = reporter.warnings
+	result.err = errors.Join(append(reporter.errors, err)...)
+	slices.SortStableFunc(result.diagnostics, func(a, b types.Diagnostic) int {
+		return cmp.Or(cmp.Compare(a.Range.Start.Line, b.Range.Start.Line),
+			cmp.Compare(a.Range.Start.Character, b.Range.Start.Character))
+	})
+
+	return result
+}
+
+// collectingReporter keeps what a single document's lint run reports. Every
+// publish holds the findings of all of its linters so far, so the last one is
+// the lot. A linter that reports on other files publishes those as well, through
+// the same run; they are the business of those files' own runs, and are left out.
+type collectingReporter struct {
+	uri types.DocumentURI
+
+	mu          sync.Mutex
+	diagnostics []types.Diagnostic
+	warnings    []string
+	errors      []error
+}
+
+func (r *collectingReporter) PublishDiagnostics(_ context.Context, params types.PublishDiagnosticsParams) {
+	if params.URI != r.uri {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.diagnostics = params.Diagnostics
+}
+
+func (r *collectingReporter) Progress(context.Context, types.ProgressParams) {}
+
+func (r *collectingReporter) ReportError(_ context.Context, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
+}
+
+func (r *collectingReporter) ReportWarning(_ context.Context, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, message)
+}
+
+var severityNames = map[types.DiagnosticSeverity]string{
+	types.DiagError:       "error",
+	types.DiagWarning:     "warning",
+	types.DiagInformation: "information",
+	types.DiagHint:        "hint",
+}
+
+// severityName names a diagnostic's severity. One without a severity is left for
+// the client to interpret, and clients show those as errors.
+func severityName(severity types.DiagnosticSeverity) string {
+	if name, ok := severityNames[severity]; ok {
+		return name
+	}
+	return severityNames[types.DiagError]
+}
+
+// parseSeverity reads a --fail-on value. "never" is the zero severity, which
+// nothing is at or above.
+func parseSeverity(name string) (types.DiagnosticSeverity, bool) {
+	switch name {
+	case "never":
+		return 0, true
+	case "info":
+		return types.DiagInformation, true
+	}
+	for severity, n := range severityNames {
+		if n == name {
+			return severity, true
+		}
+	}
+	return 0, false
+}
+
+// failsAt reports whether any of diagnostics is at least as severe as
+// threshold. Severities count down: an error is 1, a hint 4.
+func failsAt(diagnostics []types.Diagnostic, threshold types.DiagnosticSeverity) bool {
+	return slices.ContainsFunc(diagnostics, func(d types.Diagnostic) bool {
+		severity := cmp.Or(d.Severity, types.DiagError)
+		return severity <= threshold
+	})
+}
+
+var diagnosticPrinters = map[string]func(io.Writer, []lintResult) error{
+	"human":  printHuman,
+	"json":   printJSON,
+	"github": printGitHub,
+}
+
+// printHuman prints one line per diagnostic, in the file:line:column form
+// editors and terminals turn into links. Lines and columns count from 1.
+func printHuman(w io.Writer, results []lintResult) error {
+	for _, result := range results {
+		for _, d := range result.diagnostics {
+			line := fmt.Sprintf("%s:%d:%d: %s: %s", result.path,
+				d.Range.Start.Line+1, d.Range.Start.Character+1, severityName(d.Severity), d.Message)
+			if tag := diagnosticTag(d); tag != "" {
+				line += " [" + tag + "]"
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diagnosticTag is what says where a diagnostic came from: its source and
+// code, as far as it has them.
+func diagnosticTag(d types.Diagnostic) string {
+	var parts []string
+	if d.Source != nil {
+		parts = append(parts, *d.Source)
+	}
+	if d.Code != nil {
+		parts = append(parts, fmt.Sprint(*d.Code))
+	}
+	return strings.Join(parts, " ")
+}
+
+// jsonDiagnostic is a diagnostic as printed by --format json: flat, with the
+// file it is about, and counting lines and columns from 1 like the other
+// formats do.
+type jsonDiagnostic struct {
+	File      string                `json:"file"`
+	Line      int                   `json:"line"`
+	Column    int                   `json:"column"`
+	EndLine   int                   `json:"endLine"`
+	EndColumn int                   `json:"endColumn"`
+	Severity  string                `json:"severity"`
+	Code      *types.DiagnosticCode `json:"code,omitempty"`
+	Source    *string               `json:"source,omitempty"`
+	Message   string                `json:"message"`
+}
+
+func printJSON(w io.Writer, results []lintResult) error {
+	out := make([]jsonDiagnostic, 0)
+	for _, result := range results {
+		for _, d := range result.diagnostics {
+			out = append(out, jsonDiagnostic{
+				File:      result.path,
+				Line:      d.Range.Start.Line + 1,
+				Column:    d.Range.Start.Character + 1,
+				EndLine:   d.Range.End.Line + 1,
+				EndColumn: d.Range.End.Character + 1,
+				Severity:  severityName(d.Severity),
+				Code:      d.Code,
+				Source:    d.Source,
+				Message:   d.Message,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// githubCommands are the workflow commands that annotate a diagnostic of each
+// severity. GitHub has no level below notice.
+var githubCommands = map[types.DiagnosticSeverity]string{
+	types.DiagError:       "error",
+	types.DiagWarning:     "warning",
+	types.DiagInformation: "notice",
+	types.DiagHint:        "notice",
+}
+
+// printGitHub prints workflow commands, which GitHub Actions turns into
+// annotations on the lines of the pull request they are about.
+//
+// https://docs.github.com/en/actions/reference/workflow-commands-for-github-actions
+func printGitHub(w io.Writer, results []lintResult) error {
+	for _, result := range results {
+		for _, d := range result.diagnostics {
+			command := cmp.Or(githubCommands[d.Severity], "error")
+
+			properties := []string{
+				"file=" + githubProperty.Replace(filepath.ToSlash(result.path)),
+				fmt.Sprintf("line=%d", d.Range.Start.Line+1),
+				fmt.Sprintf("col=%d", d.Range.Start.Character+1),
+				fmt.Sprintf("endLine=%d", d.Range.End.Line+1),
+				fmt.Sprintf("endColumn=%d", d.Range.End.Character+1),
+			}
+			if tag := diagnosticTag(d); tag != "" {
+				properties = append(properties, "title="+githubProperty.Replace(tag))
+			}
+
+			if _, err := fmt.Fprintf(w, "::%s %s::%s\n", command, strings.Join(properties, ","),
+				githubMessage.Replace(d.Message)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// the escaping the runner undoes in a workflow command's message, and in its
+// properties, where : and , are separators
+var (
+	githubMessage  = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubProperty = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
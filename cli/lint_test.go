@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// newLintProject makes a project with one Go file and a config whose linter
+// reports a warning about it, and makes it the working directory.
+func newLintProject(t *testing.T, lint map[string]any) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the linters below are written as POSIX shell commands")
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o600))
+
+	config := map[string]any{
+		"lintCommand":        "echo 1:9:no doc comment",
+		"lintStdin":          true,
+		"lintIgnoreExitCode": true,
+		"lintFormats":        []string{"%l:%c:%m"},
+		"lintSource":         "fakelint",
+		"lintSeverity":       2,
+	}
+	for key, value := range lint {
+		config[key] = value
+	}
+
+	return writeConfig(t, dir, map[string]any{"languages": map[string]any{"go": []any{config}}})
+}
+
+func runLint(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	code = Lint(t.Context(), args, &out, &errOut)
+
+	return code, out.String(), errOut.String()
+}
+
+func TestLintPrintsDiagnostics(t *testing.T) {
+	config := newLintProject(t, nil)
+
+	code, stdout, stderr := runLint(t, "--config", config, "main.go")
+
+	assert.Equal(t, exitOK, code, "a warning does not fail the run unless asked to")
+	assert.Equal(t, "main.go:1:9: warning: no doc comment [fakelint]\n", stdout)
+	assert.Empty(t, stderr)
+}
+
+func TestLintFailOn(t *testing.T) {
+	config := newLintProject(t, nil)
+
+	tests := map[string]int{
+		"error":       exitOK,
+		"warning":     exitFindings,
+		"hint":        exitFindings,
+		"info":        exitFindings,
+		"never":       exitOK,
+		"catastrophe": exitFailure,
+	}
+
+	for failOn, want := range tests {
+		t.Run(failOn, func(t *testing.T) {
+			code, _, _ := runLint(t, "--config", config, "--fail-on", failOn, "main.go")
+			assert.Equal(t, want, code)
+		})
+	}
+}
+
+func TestLintJSON(t *testing.T) {
+	config := newLintProject(t, nil)
+
+	code, stdout, _ := runLint(t, "--config", config, "--format", "json", ".")
+	require.Equal(t, exitOK, code)
+
+	var got []jsonDiagnostic
+	require.NoError(t, json.Unmarshal([]byte(stdout), &got))
+	require.Len(t, got, 1)
+	assert.Equal(t, "main.go", filepath.Base(got[0].File))
+	assert.Equal(t, 1, got[0].Line)
+	assert.Equal(t, 9, got[0].Column)
+	assert.Equal(t, "warning", got[0].Severity)
+	assert.Equal(t, "no doc comment", got[0].Message)
+}
+
+func TestLintGitHub(t *testing.T) {
+	config := newLintProject(t, map[string]any{"lintCommand": "echo '1:9:50%, of it'"})
+
+	_, stdout, _ := runLint(t, "--config", config, "--format", "github", "main.go")
+
+	assert.Equal(t, "::warning file=main.go,line=1,col=9,endLine=1,endColumn=13,title=fakelint::50%25, of it\n", stdout)
+}
+
+// TestCollectingReporterKeepsToItsDocument covers a linter with
+// lintReportOtherFiles: its run publishes the other files open at the time
+// after the document's own final publish, and those must not be taken for it.
+func TestCollectingReporterKeepsToItsDocument(t *testing.T) {
+	own := core.ParseLocalFileToURI("/src/main.go")
+	other := core.ParseLocalFileToURI("/src/other.go")
+	reporter := &collectingReporter{uri: own}
+
+	reporter.PublishDiagnostics(t.Context(), types.PublishDiagnosticsParams{URI: own, Diagnostics: []types.Diagnostic{{Message: "in main"}}})
+	reporter.PublishDiagnostics(t.Context(), types.PublishDiagnosticsParams{URI: other, Diagnostics: []types.Diagnostic{{Message: "in other"}}})
+
+	require.Len(t, reporter.diagnostics, 1)
+	assert.Equal(t, "in main", reporter.diagnostics[0].Message)
+}
+
+func TestLintReportsLintersThatFail(t *testing.T) {
+	config := newLintProject(t, map[string]any{"lintCommand": "echo cannot run >&2; exit 127"})
+
+	code, stdout, stderr := runLint(t, "--config", config, "main.go")
+
+	assert.Equal(t, exitFailure, code, "a linter that never ran has not passed")
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "cannot run")
+}
+
+func TestLintNeedsAConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	code, _, stderr := runLint(t, "main.go")
+
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, defaultConfigFile)
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aymanbagabas/go-udiff"
+	"github.com/konradmalik/flint-ls/logs"
+)
+
+// defaultBaseRef is what a document is compared with when the config names no
+// base ref.
+const defaultBaseRef = "HEAD"
+
+// changedLines is the set of the lines of a document, 0-based, that differ from
+// what the document was at some base. A nil changedLines knows of no base, and
+// so takes every line for changed; an empty one knows the document is the same
+// as its base.
+type changedLines map[int]struct{}
+
+// overlaps reports whether any of the lines from start to end, both included,
+// changed.
+func (c changedLines) overlaps(start, end int) bool {
+	if c == nil {
+		return true
+	}
+	for line := start; line <= end; line++ {
+		if _, ok := c[line]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// diffLines returns the lines of after that are not in before. Where lines were
+// taken out and nothing put in their place, the lines on either side of the gap
+// count as changed, so that what a deletion breaks around it is not lost.
+func diffLines(before, after string) (changedLines, error) {
+	// a document and its base that differ only in their line endings, as the
+	// checkout of a repository that converts them does, have the same lines
+	before = strings.ReplaceAll(before, "\r\n", "\n")
+	after = strings.ReplaceAll(after, "\r\n", "\n")
+
+	// diffed line by line: udiff.Strings finds the characters that changed, and
+	// the line a change of a few of them ends up in is not always the one they
+	// are on
+	d, err := udiff.ToUnifiedDiff("", "", before, udiff.Lines(before, after), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(changedLines)
+	for _, h := range d.Hunks {
+		// with no context lines asked for, a hunk holds nothing but changes, and
+		// ToLine is where the first of them is in after
+		line := h.ToLine - 1
+		inserted := false
+		for _, l := range h.Lines {
+			if l.Kind == udiff.Insert {
+				changed[line] = struct{}{}
+				line++
+				inserted = true
+			}
+		}
+		if !inserted {
+			if line > 0 {
+				changed[line-1] = struct{}{}
+			}
+			changed[line] = struct{}{}
+		}
+	}
+
+	return changed, nil
+}
+
+// gitChangedLines returns the lines of f that differ from what the file is at
+// ref in the git repository rootPath is in, HEAD if ref is "". A file that is
+// not at ref, one nobody has committed yet say, has every line changed. A
+// non-nil bases saves asking git for the same base twice.
+func gitChangedLines(ctx context.Context, bases *gitBases, rootPath string, f fileRef, ref string) (changedLines, error) {
+	base, err := gitBase(ctx, bases, rootPath, f.NormalizedFilename, ref)
+	if err != nil {
+		return nil, err
+	}
+	return diffLines(base, f.Text)
+}
+
+// gitBase returns what fname is at ref in the git repository rootPath is in, or
+// "" if it is not there.
+func gitBase(ctx context.Context, bases *gitBases, rootPath, fname, ref string) (string, error) {
+	if ref == "" {
+		ref = defaultBaseRef
+	}
+
+	// git takes a path after the colon as relative to the root of the repository
+	// unless it starts with ./, and then it is relative to where git runs
+	dir, name := rootPath, ""
+	if rel, ok := relativeTo(rootPath, fname); ok {
+		name = rel
+	} else {
+		dir, name = filepath.Split(fname)
+	}
+
+	// a ref that names no commit, or a directory that is in no repository, is a
+	// mistake to report, where a file that is not at ref is not. The ref is
+	// resolved every time, since HEAD and branches move; what a file is at the
+	// commit it resolves to never changes
+	commit, err := runGit(ctx, dir, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	key := gitBaseKey{dir: dir, name: name, commit: strings.TrimSpace(commit)}
+	if base, ok := bases.get(key); ok {
+		return base, nil
+	}
+
+	base, err := runGit(ctx, dir, "show", key.commit+":./"+filepath.ToSlash(name))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		base = ""
+	}
+	bases.put(key, base)
+
+	return base, nil
+}
+
+// maxGitBases is how many bases gitBases holds on to. Enough for every document
+// open in a session to have its own, and a few commits' worth of them.
+const maxGitBases = 256
+
+// gitBases keeps what files were at the commits documents are compared with,
+// so that a linter on lintChangedLinesOnly, which runs on every edit, diffs the
+// document against a base it looked up once rather than asking git for it again
+// each time. An entry never goes stale, since a commit never changes; the oldest
+// make way for new ones past maxGitBases.
+type gitBases struct {
+	mu    sync.Mutex
+	bases map[gitBaseKey]string
+	// oldest first
+	order []gitBaseKey
+}
+
+// gitBaseKey is a file, as git is asked for it, at a resolved commit.
+type gitBaseKey struct {
+	dir, name, commit string
+}
+
+// get returns the base stored for key. A nil gitBases has none.
+func (b *gitBases) get(key gitBaseKey) (string, bool) {
+	if b == nil {
+		return "", false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	base, ok := b.bases[key]
+	return base, ok
+}
+
+// put stores base for key. A nil gitBases stores nothing.
+func (b *gitBases) put(key gitBaseKey, base string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.bases == nil {
+		b.bases = make(map[gitBaseKey]string)
+	}
+	if _, ok := b.bases[key]; ok {
+		return
+	}
+	if len(b.order) == maxGitBases {
+		delete(b.bases, b.order[0])
+		b.order = b.order[1:]
+	}
+	b.bases[key] = base
+	b.order = append(b.order, key)
+}
+
+// runGit runs git with args in dir and returns what it printed, or what it
+// complained about if it failed.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return string(out), nil
+}
+
+// changedSince is gitChangedLines for the callers that would rather do
+// everything they would have done without it than fail: it returns nil, which
+// takes every line for changed, and says why it cannot tell what changed to the
+// log and, if it is not nil, to warn.
+func changedSince(ctx context.Context, bases *gitBases, rootPath string, f fileRef, ref string, warn func(string)) changedLines {
+	changed, err := gitChangedLines(ctx, bases, rootPath, f, ref)
+	if err != nil {
+		if ctx.Err() != nil {
+			// superseded: nobody is left to tell
+			return nil
+		}
+		message := fmt.Sprintf("cannot tell what changed in %s, taking all of it: %v", f.NormalizedFilename, err)
+		logs.Log.Logln(logs.Warn, message)
+		if warn != nil {
+			warn(message)
+		}
+		return nil
+	}
+	return changed
+}
+
+// lineRun is a run of lines, from first to last, both included.
+type lineRun struct {
+	first, last int
+}
+
+// runs returns the changed lines as the runs of consecutive ones they make up,
+// in order.
+func (c changedLines) runs() []lineRun {
+	lines := slices.Sorted(maps.Keys(c))
+
+	runs := make([]lineRun, 0)
+	for _, line := range lines {
+		if n := len(runs); n > 0 && runs[n-1].last == line-1 {
+			runs[n-1].last = line
+			continue
+		}
+		runs = append(runs, lineRun{first: line, last: line})
+	}
+	return runs
+}
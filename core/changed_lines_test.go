@@ -0,0 +1,238 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          []int
+	}{
+		{"the same", "a\nb\n", "a\nb\n", []int{}},
+		{"a line changed", "a\nb\nc\n", "a\nB\nc\n", []int{1}},
+		{"lines added", "a\nb\n", "x\na\nb\ny\nz\n", []int{0, 3, 4}},
+		{"a line taken out", "a\nb\nc\n", "a\nc\n", []int{0, 1}},
+		{"the last line taken out", "a\nb\n", "a\n", []int{0, 1}},
+		{"no base", "", "a\nb\n", []int{0, 1}},
+		{"only the line endings", "a\nb\n", "a\r\nb\r\n", []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, err := diffLines(tt.before, tt.after)
+			require.NoError(t, err)
+
+			lines := make([]int, 0)
+			for line := range changed {
+				lines = append(lines, line)
+			}
+			slices.Sort(lines)
+			assert.Equal(t, tt.want, lines)
+		})
+	}
+}
+
+func TestChangedLinesOverlaps(t *testing.T) {
+	changed := changedLines{2: {}}
+	assert.True(t, changed.overlaps(2, 2))
+	assert.True(t, changed.overlaps(0, 5), "a range over several lines is changed if any of them is")
+	assert.False(t, changed.overlaps(0, 1))
+	assert.False(t, changedLines{}.overlaps(0, 1), "nothing changed")
+	assert.True(t, changedLines(nil).overlaps(0, 1), "no base to tell")
+}
+
+func TestChangedLinesRuns(t *testing.T) {
+	assert.Equal(t, []lineRun{{0, 1}, {3, 3}, {5, 7}}, changedLines{7: {}, 0: {}, 6: {}, 1: {}, 3: {}, 5: {}}.runs())
+	assert.Empty(t, changedLines{}.runs())
+}
+
+// newGitRepo makes a repository in a new directory with files committed to it,
+// one commit each, in the order given. It skips the test if there is no git to
+// do it with.
+func newGitRepo(t *testing.T, commits ...map[string]string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	// nothing the machine's git is configured with gets into the test
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		_, err := runGit(t.Context(), dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		require.NoError(t, err)
+	}
+	git("init", "--quiet")
+	for _, files := range commits {
+		for name, text := range files {
+			require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o700))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600))
+		}
+		git("add", "--all")
+		git("commit", "--quiet", "--message", "commit")
+	}
+
+	return dir
+}
+
+func TestGitChangedLines(t *testing.T) {
+	dir := newGitRepo(t,
+		map[string]string{"src/a.txt": "one\ntwo\nthree\n"},
+		map[string]string{"src/a.txt": "one\nTWO\nthree\n"})
+	file := filepath.Join(dir, "src", "a.txt")
+	f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: "one\nTWO\nthree\nfour\n"}
+
+	changed, err := gitChangedLines(t.Context(), nil, dir, f, "")
+	require.NoError(t, err)
+	assert.Equal(t, changedLines{3: {}}, changed, "against HEAD")
+
+	changed, err = gitChangedLines(t.Context(), nil, dir, f, "HEAD~1")
+	require.NoError(t, err)
+	assert.Equal(t, changedLines{1: {}, 3: {}}, changed, "against the commit before")
+
+	changed, err = gitChangedLines(t.Context(), nil, "", f, "")
+	require.NoError(t, err)
+	assert.Equal(t, changedLines{3: {}}, changed, "a document outside the root is looked for where it is")
+
+	untracked := filepath.Join(dir, "b.txt")
+	changed, err = gitChangedLines(t.Context(), nil, dir, fileRef{NormalizedFilename: filepath.ToSlash(untracked), Text: "x\ny\n"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, changedLines{0: {}, 1: {}}, changed, "a file git does not have is all changed")
+
+	_, err = gitChangedLines(t.Context(), nil, dir, f, "no-such-branch")
+	assert.ErrorContains(t, err, "git rev-parse")
+
+	elsewhere := filepath.Join(t.TempDir(), "a.txt")
+	_, err = gitChangedLines(t.Context(), nil, "", fileRef{NormalizedFilename: filepath.ToSlash(elsewhere), Text: "x\n"}, "")
+	assert.Error(t, err, "not in a repository")
+}
+
+func TestGitBasesAreReused(t *testing.T) {
+	dir := newGitRepo(t, map[string]string{"a.txt": "one\ntwo\n"})
+	file := filepath.Join(dir, "a.txt")
+	f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: "one\nTWO\n"}
+	var bases gitBases
+
+	changed, err := gitChangedLines(t.Context(), &bases, dir, f, "")
+	require.NoError(t, err)
+	assert.Equal(t, changedLines{1: {}}, changed)
+	require.Len(t, bases.order, 1)
+
+	// had git been asked again, it would not have said this
+	bases.bases[bases.order[0]] = ""
+	changed, err = gitChangedLines(t.Context(), &bases, dir, f, "")
+	require.NoError(t, err)
+	assert.Equal(t, changedLines{0: {}, 1: {}}, changed, "the base was looked up again")
+	assert.Len(t, bases.order, 1)
+}
+
+func TestLintChangedLinesOnlyWarnsWithoutABase(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	dir := newGitRepo(t, map[string]string{"a.sh": "one\n"})
+	file := filepath.Join(dir, "a.sh")
+	uri := ParseLocalFileToURI(file)
+	h := &LangHandler{
+		rootPath: dir,
+		configs: map[string][]types.Language{
+			"sh": {{
+				LintCommand:          "echo 1:first",
+				LintFormats:          []string{"%l:%m"},
+				LintStdin:            true,
+				LintIgnoreExitCode:   true,
+				LintChangedLinesOnly: true,
+				LintBaseRef:          "no-such-branch",
+			}},
+		},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {LanguageID: "sh", Text: "one\n", NormalizedFilename: filepath.ToSlash(file), Uri: uri},
+		},
+	}
+
+	reporter := &recordingReporter{}
+	require.NoError(t, h.RunAllLinters(t.Context(), reporter, uri, types.EventTypeChange))
+
+	warnings := reporter.warningMessages()
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "cannot tell what changed")
+	pd := reporter.publishedDiagnostics()
+	require.NotEmpty(t, pd)
+	assert.Len(t, pd[len(pd)-1].Diagnostics, 1, "without a base every line counts as changed")
+}
+
+func TestLintChangedLinesOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	dir := newGitRepo(t, map[string]string{"a.sh": "one\ntwo\nthree\n"})
+	file := filepath.Join(dir, "a.sh")
+	f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: "one\nTWO\nthree\n"}
+	lint := func(t *testing.T, config types.Language) []string {
+		t.Helper()
+
+		config.LintCommand = "printf '%s\\n' 1:first 2:second 3:third"
+		config.LintFormats = []string{"%l:%m"}
+		config.LintStdin = true
+		config.LintIgnoreExitCode = true
+		diagnostics, err := lintDocument(t.Context(), nil, nil, dir, f, config, nil, nil, nil, nil)
+		require.NoError(t, err)
+
+		messages := make([]string, 0)
+		for _, d := range diagnostics {
+			messages = append(messages, d.Message)
+		}
+		return messages
+	}
+
+	assert.Equal(t, []string{"first", "second", "third"}, lint(t, types.Language{}))
+	assert.Equal(t, []string{"second"}, lint(t, types.Language{LintChangedLinesOnly: true}))
+	assert.Equal(t, []string{"first", "second", "third"}, lint(t, types.Language{LintChangedLinesOnly: true, LintBaseRef: "no-such-branch"}),
+		"a base that cannot be had filters nothing")
+}
+
+func TestLintChangedLinesOnlyInOtherDocuments(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	dir := newGitRepo(t, map[string]string{"a.sh": "one\n", "b.sh": "one\ntwo\nthree\n"})
+	a := filepath.Join(dir, "a.sh")
+	b := filepath.Join(dir, "b.sh")
+	f := fileRef{NormalizedFilename: filepath.ToSlash(a), Uri: ParseLocalFileToURI(a), Text: "one\n"}
+	other := fileRef{NormalizedFilename: filepath.ToSlash(b), Uri: ParseLocalFileToURI(b), Text: "one\nTWO\nthree\n"}
+
+	others := &otherDocuments{open: func(uri types.DocumentURI) (fileRef, bool) { return other, uri == other.Uri }}
+	_, err := lintDocument(t.Context(), nil, nil, dir, f, types.Language{
+		LintCommand:          "printf '%s\\n' b.sh:1:first b.sh:2:second b.sh:3:third",
+		LintFormats:          []string{"%f:%l:%m"},
+		LintStdin:            true,
+		LintIgnoreExitCode:   true,
+		LintChangedLinesOnly: true,
+		LintReportOtherFiles: true,
+	}, nil, nil, nil, others)
+	require.NoError(t, err)
+
+	messages := make([]string, 0)
+	for _, d := range others.found[other.Uri] {
+		messages = append(messages, d.Message)
+	}
+	assert.Equal(t, []string{"second"}, messages, "another document is filtered by its own changed lines")
+}
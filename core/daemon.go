@@ -0,0 +1,534 @@
+package core
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/konradmalik/flint-ls/logs"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// defaultDaemonIdleTimeout is how long a daemon may sit unused before it is
+// stopped. Long enough to survive a coffee break between edits, short enough
+// that a language touched once in a session does not keep an interpreter
+// resident until the editor quits.
+const defaultDaemonIdleTimeout = 5 * time.Minute
+
+// defaultMaxDaemonFrame bounds a single message from a daemon whose config sets
+// no maxOutputBytes. A length prefix read out of a tool that printed something
+// else to stdout -- a banner, a stack trace -- is an arbitrary number, and must
+// not turn into an allocation of that size.
+const defaultMaxDaemonFrame = 64 << 20
+
+// defaultDaemonResponseTimeout is how long a daemon may take to answer before it
+// is taken to hang and killed. No formatter or linter worth keeping resident
+// needs this long for a single document.
+const defaultDaemonResponseTimeout = time.Minute
+
+// errDaemonClosed reports a request made after the pool stopped its daemons,
+// which happens once the server is shutting down.
+var errDaemonClosed = errors.New("tool daemons are shut down")
+
+// errDaemonTimeout reports a daemon that did not answer in time.
+var errDaemonTimeout = errors.New("daemon did not answer")
+
+// daemonRequest is what a daemon is sent for every document it is asked about.
+//
+// Each message, in both directions, is a 4-byte big-endian length followed by
+// that many bytes of JSON. A daemon answers every request with exactly one
+// daemonResponse, in the order the requests were sent.
+type daemonRequest struct {
+	Filename string `json:"filename"`
+	Text     string `json:"text"`
+	// only sent to formatters
+	Options types.FormattingOptions `json:"options,omitempty"`
+	Range   *types.Range            `json:"range,omitempty"`
+}
+
+// daemonResponse is a daemon's answer to one request. It mirrors what running
+// the tool as a process would have produced, so that everything downstream --
+// exit code rules included -- works the same whichever way the tool ran.
+type daemonResponse struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitCode"`
+}
+
+// daemonKey identifies a daemon: one process per command and working
+// directory, since a tool that caches its configuration caches it per project.
+type daemonKey struct {
+	// the expanded command, or for a tool run without a shell its arguments
+	// separated by NUL, which no argument can contain
+	command string
+	argv    bool
+	root    string
+}
+
+// daemonKeyFor returns the key of the daemon a config's command runs as.
+func daemonKeyFor(command string, args []string, rootPath string) daemonKey {
+	if len(args) > 0 {
+		return daemonKey{command: strings.Join(buildDaemonArgv(args, rootPath), "\x00"), argv: true, root: rootPath}
+	}
+	return daemonKey{command: buildDaemonCommandString(command, rootPath), root: rootPath}
+}
+
+func (k daemonKey) String() string {
+	return strings.ReplaceAll(k.command, "\x00", " ")
+}
+
+// daemonPool keeps tool processes alive between runs, so that a tool with an
+// expensive startup -- a node or python interpreter, mostly -- pays for it once
+// instead of on every keystroke. That is what prettierd and eslint_d do for
+// their own tools; a daemon here is any tool that speaks daemonRequest.
+type daemonPool struct {
+	mu              sync.Mutex
+	daemons         map[daemonKey]*daemon
+	idleTimeout     time.Duration
+	responseTimeout time.Duration
+	closed          bool
+}
+
+func newDaemonPool() *daemonPool {
+	return &daemonPool{
+		daemons:         make(map[daemonKey]*daemon),
+		idleTimeout:     defaultDaemonIdleTimeout,
+		responseTimeout: defaultDaemonResponseTimeout,
+	}
+}
+
+// daemon is one running tool process. There is a single pair of pipes and a
+// daemon answers in order, so writes are serialized by mu and responses are
+// matched to requests by their place in waiting.
+type daemon struct {
+	key    daemonKey
+	cancel context.CancelFunc
+	// done is closed once the process has exited and been reaped
+	done chan struct{}
+
+	stdout *bufio.Reader
+	// maxFrame is the most a single response may hold
+	maxFrame int64
+
+	mu    sync.Mutex
+	stdin io.WriteCloser
+	// waiting holds one channel per request still owed a response, oldest first
+	waiting []chan daemonReply
+	// broken is why the daemon can no longer be talked to, once it cannot
+	broken error
+	idle   *time.Timer
+}
+
+// daemonReply is what read hands to a waiting request.
+type daemonReply struct {
+	resp daemonResponse
+	err  error
+}
+
+func (p *daemonPool) setIdleTimeout(timeout time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.idleTimeout = timeout
+}
+
+// request sends req to the daemon for key, starting one if there is none or the
+// previous one died. A daemon that dies while it is reused -- it crashed, or was
+// idled out a moment ago -- gets one restart: the request has no side effects,
+// and the user should not see an error for a process they never asked to keep.
+// A daemon that hangs does not: it would most likely hang again.
+func (p *daemonPool) request(ctx context.Context, key daemonKey, config types.Language, req daemonRequest) (daemonResponse, error) {
+	idleTimeout, responseTimeout := p.timeouts()
+
+	for attempt := 0; ; attempt++ {
+		d, fresh, err := p.get(key, config)
+		if err != nil {
+			return daemonResponse{}, err
+		}
+
+		resp, err := d.exchange(ctx, req, responseTimeout)
+		if err == nil || ctx.Err() != nil {
+			// a caller that gave up leaves a daemon as healthy as it was
+			d.resetIdle(idleTimeout, func() { p.retire(d) })
+			if err != nil {
+				return daemonResponse{}, ctx.Err()
+			}
+			return resp, nil
+		}
+
+		// the pipe is in an unknown state: half a frame may have gone either way,
+		// so the process cannot be trusted with another request
+		p.retire(d)
+
+		if fresh || attempt > 0 || errors.Is(err, errDaemonTimeout) {
+			return daemonResponse{}, fmt.Errorf("daemon %q: %w", key, err)
+		}
+		logs.Log.Logf(logs.Info, "daemon %q died, restarting: %v", key, err)
+	}
+}
+
+func (p *daemonPool) timeouts() (idle, response time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.idleTimeout, p.responseTimeout
+}
+
+// get returns the daemon for key, and whether it was started just now.
+func (p *daemonPool) get(key daemonKey, config types.Language) (*daemon, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, false, errDaemonClosed
+	}
+
+	if d, ok := p.daemons[key]; ok {
+		select {
+		case <-d.done:
+			// exited on its own since the last request
+			delete(p.daemons, key)
+		default:
+			return d, false, nil
+		}
+	}
+
+	d, err := startDaemon(key, config)
+	if err != nil {
+		return nil, false, err
+	}
+	p.daemons[key] = d
+
+	return d, true, nil
+}
+
+// retire stops d and forgets it, unless a replacement has already taken its
+// place in the pool.
+func (p *daemonPool) retire(d *daemon) {
+	p.mu.Lock()
+	if p.daemons[d.key] == d {
+		delete(p.daemons, d.key)
+	}
+	p.mu.Unlock()
+
+	d.stop()
+}
+
+// stopWhere stops every daemon that match selects, so that the next request
+// starts it afresh.
+func (p *daemonPool) stopWhere(match func(daemonKey) bool) {
+	p.mu.Lock()
+	var stopped []*daemon
+	for key, d := range p.daemons {
+		if match(key) {
+			stopped = append(stopped, d)
+			delete(p.daemons, key)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, d := range stopped {
+		d.stop()
+	}
+}
+
+// close stops every daemon and refuses to start new ones.
+func (p *daemonPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.stopWhere(func(daemonKey) bool { return true })
+}
+
+func startDaemon(key daemonKey, config types.Language) (*daemon, error) {
+	// a daemon outlives the run that started it, so its lifetime is its own
+	// context rather than that run's
+	ctx, cancel := context.WithCancel(context.Background())
+	var cmd *exec.Cmd
+	if key.argv {
+		var err error
+		if cmd, err = buildExecArgv(ctx, strings.Split(key.command, "\x00"), key.root, config, nil); err != nil {
+			cancel()
+			return nil, fmt.Errorf("daemon %q: %w", key, err)
+		}
+	} else {
+		cmd = buildExecCmd(ctx, key.command, key.root, config, nil)
+	}
+	cmd.Stderr = daemonLog(key.String())
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := startCmd(cmd, config.Limits); err != nil {
+		cancel()
+		return nil, fmt.Errorf("daemon %q: %w", key, err)
+	}
+
+	logs.Log.Logf(logs.Info, "started daemon %q in %s", key, key.root)
+
+	d := &daemon{
+		key:    key,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		stdout: bufio.NewReader(stdout),
+		stdin:  stdin,
+		// a daemon's responses are its output, so they are held to the same
+		// bound as a one-off run's
+		maxFrame: cmp.Or(config.Limits.MaxOutputBytes, defaultMaxDaemonFrame),
+	}
+	go d.read()
+	go func() {
+		err := cmd.Wait()
+		logs.Log.Logf(logs.Info, "daemon %q exited: %v", key, err)
+		close(d.done)
+	}()
+
+	return d, nil
+}
+
+// exchange sends one request and waits for its response. A caller whose ctx is
+// cancelled stops waiting, but the daemon is left alone: a lint superseded by the
+// next keystroke is the common case, and the response it was owed is discarded
+// by read when it arrives. Only a daemon that does not answer within timeout is
+// assumed to hang, and is killed.
+//
+// The timeout covers writing the request too. A daemon that has stopped reading
+// blocks the write once the pipe fills, and every request queued behind it on
+// mu with it; killing the daemon is the only thing that unblocks them.
+func (d *daemon) exchange(ctx context.Context, req daemonRequest, timeout time.Duration) (daemonResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return daemonResponse{}, err
+	}
+
+	var timedOut atomic.Bool
+	deadline := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		d.cancel()
+	})
+	defer deadline.Stop()
+	failed := func(err error) error {
+		if timedOut.Load() {
+			return fmt.Errorf("%w after %s", errDaemonTimeout, timeout)
+		}
+		return err
+	}
+
+	// a caller that gives up halfway through the write leaves part of a frame in
+	// the pipe, which the daemon cannot make sense of, so that kills it as well
+	var writing atomic.Bool
+	stopWatch := context.AfterFunc(ctx, func() {
+		if writing.Load() {
+			d.cancel()
+		}
+	})
+
+	reply := make(chan daemonReply, 1)
+
+	d.mu.Lock()
+	if d.idle != nil {
+		d.idle.Stop()
+	}
+	if d.broken != nil {
+		d.mu.Unlock()
+		stopWatch()
+		return daemonResponse{}, d.broken
+	}
+	if err := ctx.Err(); err != nil {
+		d.mu.Unlock()
+		stopWatch()
+		return daemonResponse{}, err
+	}
+	// queued before the request is written, so that read finds it whenever the
+	// response comes
+	d.waiting = append(d.waiting, reply)
+	writing.Store(true)
+	err = writeFrame(d.stdin, body)
+	writing.Store(false)
+	d.mu.Unlock()
+	stopWatch()
+	if err != nil {
+		return daemonResponse{}, failed(err)
+	}
+
+	select {
+	case r := <-reply:
+		if r.err != nil {
+			return daemonResponse{}, failed(r.err)
+		}
+		return r.resp, nil
+	case <-ctx.Done():
+		return daemonResponse{}, ctx.Err()
+	}
+}
+
+// read hands every response the daemon writes to the request waiting longest
+// for one. A frame that cannot be read or decoded leaves the pipe in an unknown
+// state, so it fails every waiting request and kills the daemon.
+func (d *daemon) read() {
+	for {
+		var resp daemonResponse
+		body, err := readFrame(d.stdout, d.maxFrame)
+		if err == nil {
+			if err = json.Unmarshal(body, &resp); err != nil {
+				err = fmt.Errorf("malformed response: %w", err)
+			}
+		}
+
+		d.mu.Lock()
+		if err == nil && len(d.waiting) == 0 {
+			err = errors.New("response to no request")
+		}
+		if err != nil {
+			d.broken = err
+			waiting := d.waiting
+			d.waiting = nil
+			d.mu.Unlock()
+
+			for _, w := range waiting {
+				w <- daemonReply{err: err}
+			}
+			d.cancel()
+			return
+		}
+		w := d.waiting[0]
+		d.waiting = d.waiting[1:]
+		d.mu.Unlock()
+
+		w <- daemonReply{resp: resp}
+	}
+}
+
+// resetIdle arranges for retire to run once d has gone unused for timeout.
+func (d *daemon) resetIdle(timeout time.Duration, retire func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.idle == nil {
+		d.idle = time.AfterFunc(timeout, retire)
+		return
+	}
+	d.idle.Reset(timeout)
+}
+
+// stop kills the daemon and waits for it to be reaped. A request still using it
+// fails, which is what it would do if the daemon had crashed.
+func (d *daemon) stop() {
+	d.cancel()
+	<-d.done
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.idle != nil {
+		d.idle.Stop()
+	}
+}
+
+func writeFrame(w io.Writer, body []byte) error {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(body)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// readFrame reads one frame of at most limit bytes. The body is read as it
+// arrives rather than allocated up front, so a length that is a lie costs no
+// more than what actually follows it.
+func readFrame(r io.Reader, limit int64) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	n := int64(binary.BigEndian.Uint32(header[:]))
+	if n > limit {
+		return nil, fmt.Errorf("frame of %d bytes is over the limit of %d", n, limit)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r, n))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return body, nil
+}
+
+// daemonLog forwards what a daemon prints on stderr to the log. Unlike a one-off
+// run there is no request to attach it to, and it is usually startup chatter
+// anyway.
+type daemonLog string
+
+func (l daemonLog) Write(p []byte) (int, error) {
+	logs.Log.Logf(logs.Debug, "daemon %q: %s", string(l), strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// documentPlaceholders are the placeholders that name a document. A daemon serves
+// every document under its root, so these have no single value for it to start
+// with; the document's name arrives with each request instead.
+var documentPlaceholders = strings.NewReplacer(inputPlaceholder, "", filenamePlaceholder, "", fileextPlaceholder, "")
+
+// buildDaemonCommandString expands the command a daemon is started with. Only
+// ${ROOT} means anything here, and placeholders for formatting options are left
+// out: those differ per request and reach the daemon with each one.
+func buildDaemonCommandString(command, rootPath string) string {
+	command = documentPlaceholders.Replace(command)
+	command = replaceMagicStrings(command, "", rootPath)
+	return strings.TrimSpace(reUnfilledPlaceholders.ReplaceAllString(command, ""))
+}
+
+// buildDaemonArgv is buildDaemonCommandString for a tool run without a shell. An
+// argument that consisted of nothing but placeholders is dropped, rather than
+// handed to the tool as an empty string it would take for a filename.
+func buildDaemonArgv(args []string, rootPath string) []string {
+	argv := make([]string, 0, len(args))
+	for _, arg := range args {
+		expanded := dropUnfilledPlaceholders(documentPlaceholders.Replace(arg))
+		if expanded == "" && arg != "" {
+			continue
+		}
+		argv = append(argv, expanded)
+	}
+	// ${ROOT} goes in last, so that a root that happens to contain ${...} is
+	// kept as it is
+	return replaceMagicArgs(argv, "", rootPath)
+}
+
+// daemonLintOutput is runLintCommand for a daemon: what is worth parsing out of
+// its response, under the same exit code rules.
+func daemonLintOutput(resp daemonResponse, config types.Language) []byte {
+	if resp.ExitCode == 0 && !config.LintIgnoreExitCode {
+		return nil
+	}
+	switch config.LintOutputStream {
+	case types.OutputStreamStdout:
+		return []byte(resp.Stdout)
+	case types.OutputStreamStderr:
+		return []byte(resp.Stderr)
+	default:
+		return []byte(resp.Stdout + resp.Stderr)
+	}
+}
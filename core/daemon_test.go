@@ -0,0 +1,277 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// daemonHelperEnv turns the test binary into a daemon, which is how these tests
+// get a tool that speaks the protocol without shipping one.
+const daemonHelperEnv = "FLINT_LS_TEST_DAEMON=1"
+
+var daemonHelperConfig = types.Language{Env: []string{daemonHelperEnv}}
+
+// TestDaemonHelperProcess is not a test: it is the daemon the tests below start.
+// It upper-cases whatever it is sent and reports its own pid on stderr, so a test
+// can tell a reused daemon from a restarted one. A document that says "crash"
+// makes it exit without answering, one that says "slow" is answered late, one
+// that says "hang" is never answered, and one that says "huge" is answered with
+// a frame claiming to be 4 GiB long.
+func TestDaemonHelperProcess(t *testing.T) {
+	if os.Getenv("FLINT_LS_TEST_DAEMON") != "1" {
+		return
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		body, err := readFrame(in, defaultMaxDaemonFrame)
+		if err != nil {
+			os.Exit(0)
+		}
+
+		var req daemonRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			os.Exit(2)
+		}
+
+		switch req.Text {
+		case "crash":
+			os.Exit(3)
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		case "hang":
+			select {}
+		case "huge":
+			os.Stdout.Write([]byte{0xff, 0xff, 0xff, 0xff})
+			select {}
+		}
+
+		body, _ = json.Marshal(daemonResponse{Stdout: strings.ToUpper(req.Text), Stderr: fmt.Sprint(os.Getpid())})
+		if err := writeFrame(os.Stdout, body); err != nil {
+			os.Exit(4)
+		}
+	}
+}
+
+func TestDaemonIsReused(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+
+	first := requestDaemon(t, pool, key, "hello")
+	second := requestDaemon(t, pool, key, "world")
+
+	assert.Equal(t, "HELLO", first.Stdout)
+	assert.Equal(t, "WORLD", second.Stdout)
+	assert.Equal(t, first.Stderr, second.Stderr, "the second request started a process of its own")
+}
+
+func TestDaemonIsRestartedAfterACrash(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+
+	before := requestDaemon(t, pool, key, "hello")
+
+	_, err := pool.request(t.Context(), key, daemonHelperConfig, daemonRequest{Text: "crash"})
+	require.Error(t, err, "a request the daemon died on cannot be answered")
+
+	after := requestDaemon(t, pool, key, "hello")
+	assert.Equal(t, "HELLO", after.Stdout)
+	assert.NotEqual(t, before.Stderr, after.Stderr, "the crashed daemon cannot be the one answering")
+}
+
+func TestDaemonSurvivesACancelledRequest(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+	before := requestDaemon(t, pool, key, "hello")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pool.request(ctx, key, daemonHelperConfig, daemonRequest{Text: "slow"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the late answer to "slow" must not be taken for this one
+	after := requestDaemon(t, pool, key, "hello")
+	assert.Equal(t, "HELLO", after.Stdout)
+	assert.Equal(t, before.Stderr, after.Stderr, "a cancelled request must not cost the daemon its life")
+}
+
+func TestDaemonIsStoppedWhenItHangs(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+	pool.responseTimeout = 50 * time.Millisecond
+	before := requestDaemon(t, pool, key, "hello")
+
+	_, err := pool.request(t.Context(), key, daemonHelperConfig, daemonRequest{Text: "hang"})
+	require.ErrorIs(t, err, errDaemonTimeout)
+
+	after := requestDaemon(t, pool, key, "hello")
+	assert.Equal(t, "HELLO", after.Stdout)
+	assert.NotEqual(t, before.Stderr, after.Stderr, "the hung daemon cannot be the one answering")
+}
+
+func TestDaemonIsStoppedWhenItStopsReading(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+	pool.responseTimeout = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pool.request(ctx, key, daemonHelperConfig, daemonRequest{Text: "hang"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// far more than a pipe holds, to a daemon that no longer reads any of it
+	big := strings.Repeat("x", 1<<20)
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.request(t.Context(), key, daemonHelperConfig, daemonRequest{Text: big})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, errDaemonTimeout)
+	case <-time.After(5 * time.Second):
+		t.Fatal("a write to a daemon that does not read never gave up")
+	}
+
+	after := requestDaemon(t, pool, key, "hello")
+	assert.Equal(t, "HELLO", after.Stdout)
+}
+
+func TestDaemonFrameIsBounded(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+
+	_, err := pool.request(t.Context(), key, daemonHelperConfig, daemonRequest{Text: "huge"})
+	require.ErrorContains(t, err, "over the limit")
+
+	after := requestDaemon(t, pool, key, "hello")
+	assert.Equal(t, "HELLO", after.Stdout)
+}
+
+func TestDaemonIsStoppedWhenIdle(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+	pool.setIdleTimeout(10 * time.Millisecond)
+
+	requestDaemon(t, pool, key, "hello")
+
+	assert.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		return len(pool.daemons) == 0
+	}, 5*time.Second, time.Millisecond, "an idle daemon must not be kept forever")
+
+	// and an idled out daemon is simply started again
+	assert.Equal(t, "AGAIN", requestDaemon(t, pool, key, "again").Stdout)
+}
+
+func TestDaemonPoolRefusesRequestsOnceClosed(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+	requestDaemon(t, pool, key, "hello")
+
+	pool.close()
+
+	_, err := pool.request(t.Context(), key, daemonHelperConfig, daemonRequest{Text: "hello"})
+	assert.ErrorIs(t, err, errDaemonClosed)
+	assert.Empty(t, pool.daemons)
+}
+
+func TestRestartToolsStopsTheDaemons(t *testing.T) {
+	pool, key := newTestDaemonPool(t)
+	h := &LangHandler{daemons: pool}
+
+	before := requestDaemon(t, pool, key, "hello")
+	h.RestartTools()
+	assert.Empty(t, pool.daemons)
+
+	after := requestDaemon(t, pool, key, "hello")
+	assert.NotEqual(t, before.Stderr, after.Stderr, "the daemon has to be started afresh")
+}
+
+func TestLintAndFormatWithDaemons(t *testing.T) {
+	command := daemonHelperCommand(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	uri := ParseLocalFileToURI(file)
+
+	h := NewHandler(map[string][]types.Language{
+		"test": {{
+			LintCommand:        command,
+			LintDaemon:         true,
+			LintFormats:        []string{"%l:%m"},
+			LintIgnoreExitCode: true,
+			FormatCommand:      command,
+			FormatDaemon:       true,
+			Env:                []string{daemonHelperEnv},
+		}},
+	})
+	t.Cleanup(h.Close)
+
+	// upper-cased by the daemon, this reads as a diagnostic to the linter
+	require.NoError(t, h.OpenFile(uri, "test", 1, "1:problem\n"))
+
+	d, err := h.getAllDiagnosticsForUri(t, uri)
+	require.NoError(t, err)
+	require.Len(t, d, 1)
+	assert.Equal(t, "PROBLEM", d[0].Message)
+
+	edits, err := h.runAllFormatters(t, uri)
+	require.NoError(t, err)
+	require.Len(t, edits, 1)
+	assert.Equal(t, "1:PROBLEM\n", edits[0].NewText)
+
+	// the same command in the same root is the same daemon, whatever it is used for
+	assert.Len(t, h.daemons.daemons, 1)
+}
+
+func TestBuildDaemonCommandString(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the expectations below spell out POSIX shell quoting; cmd quotes differently")
+	}
+
+	got := buildDaemonCommandString("prettierd --config ${ROOT}/.prettierrc --stdin-filepath ${INPUT} ${--tab-width:tabSize}", "/my project")
+
+	assert.Equal(t, "prettierd --config '/my project'/.prettierrc --stdin-filepath", got,
+		"only the root means anything to a process that serves every document under it")
+}
+
+func TestBuildDaemonArgv(t *testing.T) {
+	got := buildDaemonArgv([]string{"prettierd", "--config", "${ROOT}/.prettierrc", "--stdin-filepath", "${INPUT}", "${--tab-width:tabSize}"}, "/my project")
+
+	assert.Equal(t, []string{"prettierd", "--config", "/my project/.prettierrc", "--stdin-filepath"}, got)
+}
+
+func newTestDaemonPool(t *testing.T) (*daemonPool, daemonKey) {
+	t.Helper()
+
+	pool := newDaemonPool()
+	t.Cleanup(pool.close)
+
+	return pool, daemonKey{command: daemonHelperCommand(t), root: t.TempDir()}
+}
+
+func daemonHelperCommand(t *testing.T) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the daemon is started through a POSIX shell")
+	}
+
+	return shellQuote(os.Args[0]) + " -test.run=^TestDaemonHelperProcess$"
+}
+
+func requestDaemon(t *testing.T, pool *daemonPool, key daemonKey, text string) daemonResponse {
+	t.Helper()
+
+	resp, err := pool.request(t.Context(), key, daemonHelperConfig, daemonRequest{Text: text})
+	require.NoError(t, err)
+
+	return resp
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/reviewdog/errorformat"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// codePlaceholder stands for a finding's code in lintCodeUrlTemplate.
+const codePlaceholder = "${CODE}"
+
+// lintDetails fills in what a config has to say about a linter's findings
+// beyond where they are and what they say.
+type lintDetails struct {
+	config      types.Language
+	codePattern *regexp.Regexp
+	tags        []codeTag
+	// the config's continuation formats that find a location, each on a line of
+	// its own, when notes are to be related information
+	continuations *errorformat.Errorformat
+}
+
+// codeTag tags the findings whose code matches pattern.
+type codeTag struct {
+	tag     types.DiagnosticTag
+	pattern *regexp.Regexp
+}
+
+func buildLintDetails(config types.Language) (lintDetails, error) {
+	details := lintDetails{config: config}
+
+	if config.LintCodePattern != "" {
+		re, err := regexp.Compile(config.LintCodePattern)
+		if err != nil {
+			return lintDetails{}, fmt.Errorf("invalid lintCodePattern %q: %w", config.LintCodePattern, err)
+		}
+		details.codePattern = re
+	}
+
+	for _, codes := range []struct {
+		tag      types.DiagnosticTag
+		option   string
+		patterns []string
+	}{
+		{types.DiagUnnecessary, "lintUnnecessaryCodes", config.LintUnnecessaryCodes},
+		{types.DiagDeprecated, "lintDeprecatedCodes", config.LintDeprecatedCodes},
+	} {
+		for _, pattern := range codes.patterns {
+			// a pattern for E1 is not meant to tag E101 as well
+			re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+			if err != nil {
+				return lintDetails{}, fmt.Errorf("invalid %s pattern %q: %w", codes.option, pattern, err)
+			}
+			details.tags = append(details.tags, codeTag{tag: codes.tag, pattern: re})
+		}
+	}
+
+	switch config.LintRangeMode {
+	case "", types.RangeModeWord, types.RangeModeLine, types.RangeModePoint, types.RangeModeUntilWhitespace:
+	case types.RangeModeSymbol:
+		if _, err := symbolRegexp(config.LintSymbolPattern); err != nil {
+			return lintDetails{}, fmt.Errorf("invalid lintSymbolPattern %q: %w", config.LintSymbolPattern, err)
+		}
+	default:
+		return lintDetails{}, fmt.Errorf("unknown lintRangeMode %q", config.LintRangeMode)
+	}
+
+	if config.LintNotesAsRelated {
+		var located []string
+		for _, format := range config.LintFormats {
+			if (strings.HasPrefix(format, "%C") || strings.HasPrefix(format, "%Z")) && strings.Contains(format, "%l") {
+				located = append(located, format[len("%C"):])
+			}
+		}
+		if len(located) > 0 {
+			efms, err := buildErrorformats(located)
+			if err != nil {
+				return lintDetails{}, err
+			}
+			details.continuations = efms
+		}
+	}
+
+	return details, nil
+}
+
+// relatedLines returns what the continuation lines of a multi-line entry point
+// at, other than where the finding itself is, as its related information. The
+// finding's message already has what those lines say: errorformat keeps the
+// file and position of a continuation line only when the finding has none of
+// its own, and this is where the rest of them go.
+//
+// A line that points somewhere without saying anything, rustc's "--> file:1:4",
+// is explained by the line before it, "note: function defined here".
+func (l lintDetails) relatedLines(entry *errorformat.Entry, rootPath string, f fileRef) []types.DiagnosticRelatedInformation {
+	if l.continuations == nil || len(entry.Lines) < 2 {
+		return nil
+	}
+
+	var related []types.DiagnosticRelatedInformation
+	var before string
+	for _, line := range entry.Lines[1:] {
+		s := l.continuations.NewScanner(strings.NewReader(line))
+		if !s.Scan() || !s.Entry().Valid || s.Entry().Lnum == 0 {
+			before = strings.TrimSpace(line)
+			continue
+		}
+
+		located, explained := s.Entry(), before
+		before = ""
+		located.Filename = replaceStdinInEntryFilename(located.Filename, l.config, f.NormalizedFilename)
+		if located.Filename == "" {
+			located.Filename = entry.Filename
+		}
+		if located.Filename == entry.Filename && located.Lnum == entry.Lnum && located.Col == entry.Col {
+			continue
+		}
+		if located.Text == "" {
+			located.Text = cmp.Or(explained, strings.TrimSpace(line))
+		}
+
+		related = append(related, noteToRelated(located, rootPath, l.config, f))
+	}
+
+	return related
+}
+
+// takeCode returns the code of the finding in entry: what lintCodePattern finds
+// in its message, which is taken out of it, or else the number the linter
+// reported. nil means it has none.
+func (l lintDetails) takeCode(entry *errorformat.Entry) *types.DiagnosticCode {
+	if l.codePattern != nil {
+		if m := l.codePattern.FindStringSubmatchIndex(entry.Text); m != nil {
+			code := entry.Text[m[0]:m[1]]
+			if len(m) >= 4 && m[2] >= 0 {
+				code = entry.Text[m[2]:m[3]]
+			}
+
+			// the code usually opens or closes the message, and what was around it
+			// should not leave it with a gap or a dangling space
+			before, after := strings.TrimSpace(entry.Text[:m[0]]), strings.TrimSpace(entry.Text[m[1]:])
+			entry.Text = strings.TrimSpace(before + " " + after)
+
+			if code != "" {
+				return types.StringCode(code)
+			}
+		}
+	}
+
+	if entry.Nr != 0 {
+		return types.IntCode(entry.Nr)
+	}
+	return nil
+}
+
+// fill adds to d, found in entry, its code along with the severity the code
+// calls for, the documentation of the code and its tags, and keeps what the
+// linter printed about it as its data.
+func (l lintDetails) fill(d *types.Diagnostic, entry *errorformat.Entry, code *types.DiagnosticCode) {
+	if len(entry.Lines) > 0 {
+		d.Data = types.LintData{Output: slices.Clone(entry.Lines)}
+	}
+
+	if code == nil {
+		return
+	}
+	d.Code = code
+	d.Severity = getSeverity(entry.Type, code, l.config.LintCategoryMap, l.config.LintSeverity)
+
+	if l.config.LintCodeURLTemplate != "" {
+		d.CodeDescription = &types.CodeDescription{
+			Href: strings.ReplaceAll(l.config.LintCodeURLTemplate, codePlaceholder, url.PathEscape(code.String())),
+		}
+	}
+	for _, t := range l.tags {
+		if t.pattern.MatchString(code.String()) && !slices.Contains(d.Tags, t.tag) {
+			d.Tags = append(d.Tags, t.tag)
+		}
+	}
+}
+
+// isNote reports whether entry is a note about the finding before it rather than
+// a finding of its own.
+func isNote(entry *errorformat.Entry) bool {
+	return entry.Type == 'n' || entry.Type == 'N'
+}
+
+// noteToRelated turns a note into related information of the finding it is
+// about. A note without a file of its own is about the document being linted.
+func noteToRelated(entry *errorformat.Entry, rootPath string, config types.Language, f fileRef) types.DiagnosticRelatedInformation {
+	uri := f.Uri
+	if entry.Filename != "" {
+		uri = entryURI(rootPath, entry)
+	}
+
+	// only the document's own text is at hand to find where a word ends in, so a
+	// note about another file points at where it starts
+	text := fileRef{}
+	if comparePaths(string(uri), string(f.Uri)) {
+		text = f
+	}
+
+	return types.DiagnosticRelatedInformation{
+		Location: types.Location{URI: uri, Range: parseEfmEntryToDiagnostic(entry, config, text).Range},
+		Message:  entry.Text,
+	}
+}
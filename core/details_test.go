@@ -0,0 +1,236 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/reviewdog/errorformat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestLintDetailsFill(t *testing.T) {
+	details, err := buildLintDetails(types.Language{
+		LintCodeURLTemplate:  "https://example.com/rules/${CODE}",
+		LintUnnecessaryCodes: []string{"40[0-9]", "841"},
+		LintDeprecatedCodes:  []string{"4"},
+	})
+	require.NoError(t, err)
+
+	t.Run("a code", func(t *testing.T) {
+		d := types.Diagnostic{}
+		details.fill(&d, &errorformat.Entry{Lines: []string{"foo:1: 401 unused import"}}, types.IntCode(401))
+
+		assert.Equal(t, types.IntCode(401), d.Code)
+		require.NotNil(t, d.CodeDescription)
+		assert.Equal(t, "https://example.com/rules/401", d.CodeDescription.Href)
+		assert.Equal(t, []types.DiagnosticTag{types.DiagUnnecessary}, d.Tags,
+			"a pattern has to match the whole code, so 4 says nothing about 401")
+		assert.Equal(t, types.LintData{Output: []string{"foo:1: 401 unused import"}}, d.Data)
+	})
+
+	t.Run("no code", func(t *testing.T) {
+		d := types.Diagnostic{}
+		details.fill(&d, &errorformat.Entry{}, nil)
+
+		assert.Equal(t, types.Diagnostic{}, d, "there is nothing to document or tag, nor any output to keep")
+	})
+}
+
+func TestBuildLintDetailsRejectsABadPattern(t *testing.T) {
+	_, err := buildLintDetails(types.Language{LintDeprecatedCodes: []string{"("}})
+	assert.ErrorContains(t, err, "lintDeprecatedCodes")
+
+	_, err = buildLintDetails(types.Language{LintCodePattern: "("})
+	assert.ErrorContains(t, err, "lintCodePattern")
+}
+
+func TestLintNotesAsRelated(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "foo.c")
+	other := filepath.Join(dir, "other.h")
+	output := fmt.Sprintf(`printf '%%s\n' %q %q %q %q %q; exit 1`,
+		file+":1:1: error: bad thing",
+		"other.h:3:2: note: declared here",
+		file+":2:1: note: see also",
+		"other.h:5:1: error: not ours",
+		"other.h:6:1: note: about what is not ours")
+	config := types.Language{
+		LintCommand: output,
+		LintFormats: []string{"%f:%l:%c: %trror: %m", "%f:%l:%c: %tote: %m"},
+	}
+
+	f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: "int x;\nint y;\n"}
+
+	t.Run("off", func(t *testing.T) {
+		diagnostics, err := lintDocument(t.Context(), nil, nil, dir, f, config, nil, nil, nil, nil)
+		require.NoError(t, err)
+
+		require.Len(t, diagnostics, 2, "a note is a finding of its own")
+		assert.Equal(t, "see also", diagnostics[1].Message)
+	})
+
+	t.Run("on", func(t *testing.T) {
+		config := config
+		config.LintNotesAsRelated = true
+
+		diagnostics, err := lintDocument(t.Context(), nil, nil, dir, f, config, nil, nil, nil, nil)
+		require.NoError(t, err)
+
+		require.Len(t, diagnostics, 1)
+		assert.Equal(t, "bad thing", diagnostics[0].Message)
+		assert.Equal(t, []types.DiagnosticRelatedInformation{
+			{
+				Location: types.Location{
+					URI:   ParseLocalFileToURI(other),
+					Range: types.Range{Start: types.Position{Line: 2, Character: 1}, End: types.Position{Line: 2, Character: 1}},
+				},
+				Message: "declared here",
+			},
+			{
+				Location: types.Location{
+					URI:   f.Uri,
+					Range: types.Range{Start: types.Position{Line: 1, Character: 0}, End: types.Position{Line: 1, Character: 3}},
+				},
+				Message: "see also",
+			},
+		}, diagnostics[0].RelatedInformation, "a note about a finding that is not ours goes the way of that finding")
+	})
+}
+
+func TestMultiLineFindings(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is a POSIX tool")
+	}
+
+	lint := func(t *testing.T, output, name, text string, formats []string) (fileRef, []types.Diagnostic) {
+		t.Helper()
+
+		printed, err := filepath.Abs(filepath.Join("testdata", "multiline", output))
+		require.NoError(t, err)
+		dir := t.TempDir()
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: text}
+
+		diagnostics, err := lintDocument(t.Context(), nil, nil, dir, f, types.Language{
+			LintArgs:           []string{"cat", printed},
+			LintStdin:          true,
+			LintIgnoreExitCode: true,
+			LintFormats:        formats,
+			LintNotesAsRelated: true,
+		}, nil, nil, nil, nil)
+		require.NoError(t, err)
+
+		return f, diagnostics
+	}
+
+	t.Run("gcc", func(t *testing.T) {
+		f, diagnostics := lint(t, "gcc.txt", "main.c", "#include \"util.h\"\n\n\nvoid f(void) {}\n", []string{
+			"%-G%f: In function %.%#",
+			"%E%f:%l:%c: error: %m",
+			"%W%f:%l:%c: warning: %m",
+			"%C%f:%l:%c: note: %m",
+			"%C%.%#",
+		})
+
+		require.Len(t, diagnostics, 2)
+		assert.Equal(t, "conflicting types for 'f'; have 'void(void)'\nprevious declaration of 'f' with type 'void(int)'", diagnostics[0].Message,
+			"what every line says is kept")
+		assert.Equal(t, types.Position{Line: 3, Character: 5}, diagnostics[0].Range.Start)
+		require.Len(t, diagnostics[0].RelatedInformation, 1)
+		related := diagnostics[0].RelatedInformation[0]
+		assert.Equal(t, ParseLocalFileToURI(filepath.Join(filepath.Dir(f.NormalizedFilename), "util.h")), related.Location.URI)
+		assert.Equal(t, types.Position{Line: 2, Character: 5}, related.Location.Range.Start)
+		assert.Equal(t, "previous declaration of 'f' with type 'void(int)'", related.Message)
+		assert.Len(t, diagnostics[0].Data.(types.LintData).Output, 7, "as is all the compiler printed about it")
+
+		assert.Equal(t, "unused variable 'y' [-Wunused-variable]", diagnostics[1].Message)
+		assert.Empty(t, diagnostics[1].RelatedInformation)
+	})
+
+	t.Run("rustc", func(t *testing.T) {
+		text := "fn add_one(x: i32) -> i32 {\n    x + 1\n}\n\nfn main() {\n    add_one(1, 2);\n    let y = 2;\n}\n"
+		f, diagnostics := lint(t, "rustc.txt", "src/main.rs", text, []string{
+			"%-Gerror: aborting %.%#",
+			"%-GFor more information %.%#",
+			"%Eerror[E%n]: %m",
+			"%Eerror: %m",
+			"%Wwarning: %m",
+			"%C %#--> %f:%l:%c",
+			"%C%.%#",
+		})
+
+		require.Len(t, diagnostics, 2)
+		assert.Equal(t, "this function takes 1 argument but 2 arguments were supplied", diagnostics[0].Message)
+		assert.Equal(t, types.Position{Line: 5, Character: 4}, diagnostics[0].Range.Start,
+			"the finding is where the first line that says where points")
+		require.Len(t, diagnostics[0].RelatedInformation, 1, "and only what points elsewhere is related")
+		related := diagnostics[0].RelatedInformation[0]
+		assert.Equal(t, f.Uri, related.Location.URI)
+		assert.Equal(t, types.Position{Line: 0, Character: 3}, related.Location.Range.Start)
+		assert.Equal(t, "note: function defined here", related.Message, "explained by the line before it")
+
+		assert.Equal(t, "unused variable: `y`", diagnostics[1].Message)
+		assert.Equal(t, types.Position{Line: 6, Character: 8}, diagnostics[1].Range.Start)
+		assert.Empty(t, diagnostics[1].RelatedInformation)
+	})
+}
+
+func TestTakeCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		text     string
+		nr       int
+		wantCode *types.DiagnosticCode
+		wantText string
+	}{
+		{"a code opening the message", `^\[(\S+)\]`, "[E501] line too long", 0, types.StringCode("E501"), "line too long"},
+		{"a code inside the message", `\((\w+)\)`, "line too long (E501) here", 0, types.StringCode("E501"), "line too long here"},
+		{"a pattern without a group", `SC\d+`, "SC2086 double quote to prevent globbing", 0, types.StringCode("SC2086"), "double quote to prevent globbing"},
+		{"a code that looks like a number is still a string", `^(\d+):`, "0042: whatever", 0, types.StringCode("0042"), "whatever"},
+		{"no match keeps the linter's number", `^\[(\S+)\]`, "line too long", 501, types.IntCode(501), "line too long"},
+		{"an empty match keeps the linter's number", `^\[(\S*)\]`, "[] line too long", 501, types.IntCode(501), "line too long"},
+		{"no pattern", "", "[E501] line too long", 0, nil, "[E501] line too long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, err := buildLintDetails(types.Language{LintCodePattern: tt.pattern})
+			require.NoError(t, err)
+
+			entry := &errorformat.Entry{Text: tt.text, Nr: tt.nr}
+			assert.Equal(t, tt.wantCode, details.takeCode(entry))
+			assert.Equal(t, tt.wantText, entry.Text)
+		})
+	}
+}
+
+func TestLintCodePattern(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.py")
+	f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: "x = 1\n"}
+
+	diagnostics, err := lintDocument(t.Context(), nil, nil, filepath.Dir(file), f, types.Language{
+		LintCommand:        "echo 1:[E501] line too long",
+		LintStdin:          true,
+		LintFormats:        []string{"%l:%m"},
+		LintIgnoreExitCode: true,
+		LintCodePattern:    `^\[(\S+)\]`,
+		LintCategoryMap:    map[string]string{"E501": "W"},
+		Prefix:             "ruff",
+	}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, types.StringCode("E501"), diagnostics[0].Code)
+	assert.Equal(t, "[ruff] line too long", diagnostics[0].Message, "the code is taken out of the message, not the prefix")
+	assert.Equal(t, types.DiagWarning, diagnostics[0].Severity, "the category map can key off the code")
+}
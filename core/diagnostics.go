@@ -0,0 +1,261 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// diagnosticStore keeps the last diagnostics every linter found in every
+// document, so that a publish -- which replaces the client's whole set for the
+// document -- can carry what the linters that are not done yet, or did not run
+// at all, found before. Its zero value is ready to use.
+type diagnosticStore struct {
+	// mu is held across a publish as well, which keeps one publish from
+	// overtaking another with an older view of the findings. A publish looks up
+	// open documents under it, so it is never taken while holding LangHandler.mu
+	mu        sync.Mutex
+	documents map[types.DocumentURI]*storedDiagnostics
+}
+
+// storedDiagnostics is what the linters found in one document.
+type storedDiagnostics struct {
+	// the document's own linters, in the order their findings are published in,
+	// as of the last publish of a run of its own
+	linters []string
+	// what each of those linters found linting the document
+	own map[string][]types.Diagnostic
+	// what linters found in the document linting another one, with
+	// lintReportOtherFiles
+	reported map[reportedBy][]types.Diagnostic
+}
+
+// reportedBy names the linter that reported on a document while linting the
+// document at uri.
+type reportedBy struct {
+	uri    types.DocumentURI
+	linter string
+}
+
+// document returns what is stored for uri, making room for it if need be.
+func (s *diagnosticStore) document(uri types.DocumentURI) *storedDiagnostics {
+	if s.documents == nil {
+		s.documents = make(map[types.DocumentURI]*storedDiagnostics)
+	}
+	stored, ok := s.documents[uri]
+	if !ok {
+		stored = &storedDiagnostics{own: make(map[string][]types.Diagnostic), reported: make(map[reportedBy][]types.Diagnostic)}
+		s.documents[uri] = stored
+	}
+
+	return stored
+}
+
+// forget drops everything stored for uri, and what its linters reported about
+// other documents. It returns those documents, in order: the client shows them
+// with what was dropped until they are published again.
+func (s *diagnosticStore) forget(uri types.DocumentURI) []types.DocumentURI {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.documents, uri)
+	var changed []types.DocumentURI
+	for other, stored := range s.documents {
+		before := len(stored.reported)
+		maps.DeleteFunc(stored.reported, func(by reportedBy, _ []types.Diagnostic) bool { return by.uri == uri })
+		if len(stored.reported) != before {
+			changed = append(changed, other)
+		}
+	}
+	slices.Sort(changed)
+
+	return changed
+}
+
+// republish publishes what is stored for each of uris, as far as filter lets it
+// through and the document is still open.
+func (s *diagnosticStore) republish(ctx context.Context, reporter Reporter, filter diagnosticFilter, open func(types.DocumentURI) (fileRef, bool), uris []types.DocumentURI) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.publishStored(ctx, reporter, filter, open, uris)
+}
+
+// publishStored is republish for a caller that holds mu. A document that is no
+// longer open has nothing kept for it.
+func (s *diagnosticStore) publishStored(ctx context.Context, reporter Reporter, filter diagnosticFilter, open func(types.DocumentURI) (fileRef, bool), uris []types.DocumentURI) {
+	for _, uri := range uris {
+		doc, ok := open(uri)
+		if !ok {
+			// closed since it was linted; nothing is to be kept for it
+			delete(s.documents, uri)
+			continue
+		}
+		reporter.PublishDiagnostics(ctx, types.PublishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: filter.apply(s.document(uri).merged("", nil)),
+			Version:     doc.Version,
+		})
+	}
+}
+
+// merged is every diagnostic stored for the document, with what linter found
+// replaced by diagnostics: its own linters' in their order, then what the others
+// reported, in an order that stays put from one publish to the next. A linter
+// that has linted the document itself knows better than it did linting another
+// one, so what it reported from there is left out.
+func (d *storedDiagnostics) merged(linter string, diagnostics []types.Diagnostic) []types.Diagnostic {
+	published := make([]types.Diagnostic, 0)
+	for _, id := range d.linters {
+		if id == linter {
+			published = append(published, diagnostics...)
+		} else {
+			published = append(published, d.own[id]...)
+		}
+	}
+
+	reporters := slices.SortedFunc(maps.Keys(d.reported), func(a, b reportedBy) int {
+		return cmp.Or(cmp.Compare(a.uri, b.uri), cmp.Compare(a.linter, b.linter))
+	})
+	for _, by := range reporters {
+		if _, ok := d.own[by.linter]; !ok && by.linter != linter {
+			published = append(published, d.reported[by]...)
+		}
+	}
+
+	return published
+}
+
+// lintPublisher publishes the findings of the linters of one run.
+type lintPublisher struct {
+	store    *diagnosticStore
+	reporter Reporter
+	uri      types.DocumentURI
+	version  int
+	// every linter that applies to the document, whatever the events of the run,
+	// in the order their findings are published in. What any other linter found
+	// is forgotten: it is no longer configured, or no longer for this document
+	linters []string
+	// what of the findings of them all is published
+	filter diagnosticFilter
+	// returns the open document at uri, for publishing what the linters reported
+	// about documents other than this one
+	open func(types.DocumentURI) (fileRef, bool)
+}
+
+// publish sends the client what every linter has found in the document, with
+// what linter found replaced by diagnostics, as far as the filter lets it through.
+// A final publish is linter's result for the run and is kept for the publishes
+// that follow. One made while linter is still going is not: if the run is
+// superseded, what the linter found last time is a better guess than what it got
+// to before it was killed.
+func (p lintPublisher) publish(ctx context.Context, linter string, diagnostics []types.Diagnostic, final bool) {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+
+	// a cancelled run's results describe text the client has already replaced.
+	// it publishes nothing rather than what it has: killing the linter left it
+	// with nothing, and sending that would wipe out whatever the run that
+	// superseded this one has published
+	if ctx.Err() != nil {
+		return
+	}
+
+	stored := p.store.document(p.uri)
+	stored.linters = p.linters
+	maps.DeleteFunc(stored.own, func(id string, _ []types.Diagnostic) bool { return !slices.Contains(p.linters, id) })
+	if final {
+		stored.own[linter] = diagnostics
+	}
+
+	p.reporter.PublishDiagnostics(ctx, types.PublishDiagnosticsParams{
+		URI:         p.uri,
+		Diagnostics: p.filter.apply(stored.merged(linter, diagnostics)),
+		Version:     p.version,
+	})
+}
+
+// retract publishes the document again with what linter found the last time it
+// was done, taking back what it published as it went in a run that then failed.
+func (p lintPublisher) retract(ctx context.Context, linter string) {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	stored := p.store.document(p.uri)
+	p.reporter.PublishDiagnostics(ctx, types.PublishDiagnosticsParams{
+		URI:         p.uri,
+		Diagnostics: p.filter.apply(stored.merged(linter, stored.own[linter])),
+		Version:     p.version,
+	})
+}
+
+// publishOthers takes what linter found in other documents linting this one in
+// place of what it found there the last time, and publishes every document that
+// changes for, as far as it is still open.
+func (p lintPublisher) publishOthers(ctx context.Context, linter string, found map[types.DocumentURI][]types.Diagnostic) {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	by := reportedBy{uri: p.uri, linter: linter}
+	var changed []types.DocumentURI
+	for uri, stored := range p.store.documents {
+		if _, ok := stored.reported[by]; ok && found[uri] == nil {
+			delete(stored.reported, by)
+			changed = append(changed, uri)
+		}
+	}
+	for uri, diagnostics := range found {
+		p.store.document(uri).reported[by] = diagnostics
+		changed = append(changed, uri)
+	}
+
+	slices.Sort(changed)
+	p.store.publishStored(ctx, p.reporter, p.filter, p.open, changed)
+}
+
+// linterIDs names each config's linter by its command. Configs running the same
+// command are told apart by their position among those that do, which leaves a
+// linter's name the same for every run of the document, whichever linters the
+// run's events pick.
+func linterIDs(configs []resolvedConfig) []string {
+	ids := make([]string, 0, len(configs))
+	seen := make(map[string]int)
+	for _, cfg := range configs {
+		command := cfg.LintCommand
+		if len(cfg.LintArgs) > 0 {
+			command = strings.Join(cfg.LintArgs, " ")
+		}
+
+		ids = append(ids, fmt.Sprintf("%s#%d", command, seen[command]))
+		seen[command]++
+	}
+
+	return ids
+}
+
+// ClearDiagnostics forgets what the linters found in uri, so that the next run
+// publishes only what its own linters find. The other open documents its linters
+// reported on are published again without what they reported.
+func (h *LangHandler) ClearDiagnostics(ctx context.Context, reporter Reporter, uri types.DocumentURI) {
+	h.mu.RLock()
+	filter := h.filter
+	h.mu.RUnlock()
+
+	// not under mu: a publish holds the store while it looks up open documents
+	changed := h.diagnostics.forget(uri)
+	h.diagnostics.republish(ctx, reporter, filter, h.openFile, changed)
+}
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestDiagnosticsOfLintersThatDidNotRunStay(t *testing.T) {
+	off := false
+	onSave := types.Language{
+		LintCommand:        "echo 1:on save",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+		LintAfterOpen:      &off,
+		LintOnChange:       &off,
+	}
+	onChange := types.Language{
+		LintCommand:        "echo 2:on change",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+		LintAfterOpen:      &off,
+		LintOnSave:         &off,
+	}
+	h, uri := newStoreTestHandler(t, onSave, onChange)
+
+	assert.Equal(t, []string{"on save"}, lastPublishedMessages(t, h, uri, types.EventTypeSave))
+	assert.Equal(t, []string{"on change", "on save"}, lastPublishedMessages(t, h, uri, types.EventTypeChange),
+		"what the save linter found stands until it runs again")
+
+	h.ClearDiagnostics(t.Context(), &recordingReporter{}, uri)
+	assert.Equal(t, []string{"on change"}, lastPublishedMessages(t, h, uri, types.EventTypeChange),
+		"nothing is left of what was cleared")
+
+	lastPublishedMessages(t, h, uri, types.EventTypeSave)
+	h.UpdateConfiguration(&types.Config{Languages: map[string][]types.Language{"vim": {onChange}}})
+	assert.Equal(t, []string{"on change"}, lastPublishedMessages(t, h, uri, types.EventTypeChange),
+		"a linter that is gone from the configuration takes its findings with it")
+}
+
+func TestDiagnosticsOfAFailingLinterStay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	// reports the document's first line, and fails to run on a document that has
+	// none
+	h, uri := newStoreTestHandler(t, types.Language{
+		LintCommand: `if read -r line; then echo "$line"; exit 1; else echo cannot lint >&2; exit 127; fi`,
+		LintFormats: []string{"%l:%m"},
+		LintStdin:   true,
+	})
+
+	require.NoError(t, h.UpdateFile(uri, "1:problem\n", nil))
+	assert.Equal(t, []string{"problem"}, lastPublishedMessages(t, h, uri, types.EventTypeChange))
+
+	require.NoError(t, h.UpdateFile(uri, "", nil))
+	reporter := &recordingReporter{}
+	require.NoError(t, h.RunAllLinters(t.Context(), reporter, uri, types.EventTypeChange))
+	assert.NotEmpty(t, reporter.errorMessages())
+	assert.Empty(t, reporter.publishedDiagnostics(), "the findings from before the failure stay up")
+
+	h.CloseFile(uri)
+	assert.Empty(t, h.diagnostics.documents, "a closed document leaves nothing behind")
+}
+
+func TestLintReportOtherFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is a POSIX tool")
+	}
+
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report")
+	// a package linter: what it finds in the package, whichever file it lints
+	packageLinter := types.Language{
+		LintArgs:             []string{"cat", report},
+		LintFormats:          []string{"%f:%l:%m"},
+		LintStdin:            true,
+		LintIgnoreExitCode:   true,
+		LintReportOtherFiles: true,
+	}
+	ownLinter := types.Language{
+		LintCommand:        "echo 1:own",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+	}
+	h := NewHandler(map[string][]types.Language{"go": {packageLinter}, "other": {ownLinter}})
+	t.Cleanup(h.Close)
+	_, err := h.Initialize(types.InitializeParams{RootURI: ParseLocalFileToURI(dir)})
+	require.NoError(t, err)
+
+	a := ParseLocalFileToURI(filepath.Join(dir, "a.go"))
+	b := ParseLocalFileToURI(filepath.Join(dir, "b.go"))
+	require.NoError(t, h.OpenFile(a, "go", 1, "package a\nfunc f() {}\n"))
+	require.NoError(t, h.OpenFile(b, "other", 3, "package a\n"))
+
+	// lint runs a's linters and returns the last set published for each
+	// document, by its messages
+	lint := func(t *testing.T, printed string) map[types.DocumentURI][]string {
+		t.Helper()
+
+		require.NoError(t, os.WriteFile(report, []byte(printed), 0o600))
+		reporter := &recordingReporter{}
+		require.NoError(t, h.RunAllLinters(t.Context(), reporter, a, types.EventTypeChange))
+
+		published := make(map[types.DocumentURI][]string)
+		for _, params := range reporter.publishedDiagnostics() {
+			messages := make([]string, 0)
+			for _, d := range params.Diagnostics {
+				messages = append(messages, d.Message)
+			}
+			published[params.URI] = messages
+			if params.URI == b {
+				assert.Equal(t, 3, params.Version, "b is published at its own version")
+			}
+		}
+		return published
+	}
+
+	assert.Equal(t, map[types.DocumentURI][]string{a: {"in a"}, b: {"in b"}},
+		lint(t, "a.go:2:in a\nb.go:1:in b\nc.go:1:in c, which is not open\n"))
+
+	assert.Equal(t, []string{"in b", "own"}, lastPublishedMessages(t, h, b, types.EventTypeChange),
+		"what b's own linters find is merged with what was found in it linting a")
+
+	assert.Equal(t, map[types.DocumentURI][]string{a: {"in a"}, b: {"own"}}, lint(t, "a.go:2:in a\n"),
+		"b loses what a's linter no longer finds in it")
+
+	lint(t, "b.go:1:in b\n")
+	reporter := &recordingReporter{}
+	h.ClearDiagnostics(t.Context(), reporter, a)
+	published := reporter.publishedDiagnostics()
+	require.Len(t, published, 1)
+	assert.Equal(t, b, published[0].URI)
+	require.Len(t, published[0].Diagnostics, 1)
+	assert.Equal(t, "own", published[0].Diagnostics[0].Message,
+		"clearing a publishes b without what a's linters found in it")
+
+	lint(t, "b.go:1:in b\n")
+	h.CloseFile(a)
+	assert.Equal(t, []string{"own"}, lastPublishedMessages(t, h, b, types.EventTypeChange),
+		"what a's linters found elsewhere goes with it")
+
+	h.UpdateConfiguration(&types.Config{LintExclude: []string{"b.go"}})
+	require.NoError(t, h.OpenFile(a, "go", 1, ""))
+	assert.Equal(t, map[types.DocumentURI][]string{a: {}}, lint(t, "b.go:1:in b\n"),
+		"a document no linter runs on gets no findings from one")
+
+	excluding := packageLinter
+	excluding.LintExclude = []string{"b.go"}
+	h.UpdateConfiguration(&types.Config{LintExclude: []string{}, Languages: map[string][]types.Language{"go": {excluding}, "other": {ownLinter}}})
+	assert.Equal(t, map[types.DocumentURI][]string{a: {}}, lint(t, "b.go:1:in b\n"),
+		"nor does one the linter itself is not to run on")
+}
+
+func TestStoredDiagnosticsMerged(t *testing.T) {
+	found := func(messages ...string) []types.Diagnostic {
+		diagnostics := make([]types.Diagnostic, 0)
+		for _, m := range messages {
+			diagnostics = append(diagnostics, types.Diagnostic{Message: m})
+		}
+		return diagnostics
+	}
+	stored := storedDiagnostics{
+		linters: []string{"vet#0", "lint#0"},
+		own:     map[string][]types.Diagnostic{"vet#0": found("vet"), "lint#0": found("lint")},
+		reported: map[reportedBy][]types.Diagnostic{
+			{uri: "file:///z.go", linter: "pkg#0"}: found("pkg from z"),
+			{uri: "file:///a.go", linter: "pkg#0"}: found("pkg from a"),
+			{uri: "file:///a.go", linter: "vet#0"}: found("vet from a"),
+		},
+	}
+	messages := func(diagnostics []types.Diagnostic) []string {
+		m := make([]string, 0)
+		for _, d := range diagnostics {
+			m = append(m, d.Message)
+		}
+		return m
+	}
+
+	assert.Equal(t, []string{"vet", "lint", "pkg from a", "pkg from z"}, messages(stored.merged("", nil)),
+		"a linter's own findings go before and in place of what it reported linting another document")
+	assert.Equal(t, []string{"vet", "lint again", "pkg from a", "pkg from z"}, messages(stored.merged("lint#0", found("lint again"))))
+
+	delete(stored.own, "vet#0")
+	assert.Equal(t, []string{"lint", "pkg from a", "vet from a", "pkg from z"}, messages(stored.merged("", nil)))
+	assert.Equal(t, []string{"vet so far", "lint", "pkg from a", "pkg from z"}, messages(stored.merged("vet#0", found("vet so far"))),
+		"nor is it while the linter is going")
+}
+
+func TestLinterIDs(t *testing.T) {
+	configs := []resolvedConfig{
+		{Language: types.Language{LintCommand: "eslint"}},
+		{Language: types.Language{LintArgs: []string{"ruff", "check"}}},
+		{Language: types.Language{LintCommand: "eslint"}},
+		// the arguments are what runs
+		{Language: types.Language{LintCommand: "unused", LintArgs: []string{"ruff", "check"}}},
+	}
+
+	assert.Equal(t, []string{"eslint#0", "ruff check#0", "eslint#1", "ruff check#1"}, linterIDs(configs))
+}
+
+func newStoreTestHandler(t *testing.T, configs ...types.Language) (*LangHandler, types.DocumentURI) {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "foo")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	uri := ParseLocalFileToURI(file)
+
+	h := NewHandler(map[string][]types.Language{"vim": configs})
+	t.Cleanup(h.Close)
+	require.NoError(t, h.OpenFile(uri, "vim", 1, "one\ntwo\n"))
+
+	return h, uri
+}
+
+// lastPublishedMessages lints uri for events and returns the messages of the set
+// the client is left with, sorted.
+func lastPublishedMessages(t *testing.T, h *LangHandler, uri types.DocumentURI, events types.EventType) []string {
+	t.Helper()
+
+	pd, err := h.getAllPublishDiagnosticsParamsForUriWithEvent(t, uri, events)
+	require.NoError(t, err)
+	require.NotEmpty(t, pd, "nothing was published")
+
+	messages := make([]string, 0)
+	for _, d := range pd[len(pd)-1].Diagnostics {
+		messages = append(messages, d.Message)
+	}
+	slices.Sort(messages)
+
+	return messages
+}
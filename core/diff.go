@@ -1,6 +1,10 @@
 package core
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"unicode/utf16"
 
@@ -70,3 +74,80 @@ func utf16Len(s string) int {
 	}
 	return n
 }
+
+// ApplyEdits applies text edits to text the way a client would, for the callers
+// that have no client to do it for them. The edits may come in any order but must
+// not overlap, and every position must exist in text.
+func ApplyEdits(text string, edits []types.TextEdit) (string, error) {
+	type span struct {
+		start, end int
+		newText    string
+	}
+
+	spans := make([]span, 0, len(edits))
+	for _, e := range edits {
+		start, err := positionOffset(text, e.Range.Start)
+		if err != nil {
+			return "", err
+		}
+		end, err := positionOffset(text, e.Range.End)
+		if err != nil {
+			return "", err
+		}
+		if end < start {
+			return "", fmt.Errorf("edit ends before it starts: %+v", e.Range)
+		}
+		spans = append(spans, span{start, end, e.NewText})
+	}
+	// stable, so that insertions at the same place keep the order they came in
+	slices.SortStableFunc(spans, func(a, b span) int { return cmp.Compare(a.start, b.start) })
+
+	var result strings.Builder
+	offset := 0
+	for _, s := range spans {
+		if s.start < offset {
+			return "", errors.New("edits overlap")
+		}
+		result.WriteString(text[offset:s.start])
+		result.WriteString(s.newText)
+		offset = s.end
+	}
+	result.WriteString(text[offset:])
+
+	return result.String(), nil
+}
+
+// positionOffset converts an lsp position into a byte offset into text.
+func positionOffset(text string, pos types.Position) (int, error) {
+	if pos.Line < 0 || pos.Character < 0 {
+		return 0, fmt.Errorf("no position %+v", pos)
+	}
+
+	offset := 0
+	for range pos.Line {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("no line %d", pos.Line)
+		}
+		offset += i + 1
+	}
+
+	line := text[offset:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	character := 0
+	for i, r := range line {
+		if character == pos.Character {
+			return offset + i, nil
+		}
+		character += utf16.RuneLen(r)
+	}
+	// just past the end of the line is a position too, but nothing beyond it, and
+	// nothing inside a surrogate pair
+	if character != pos.Character {
+		return 0, fmt.Errorf("no character %d on line %d", pos.Character, pos.Line)
+	}
+	return offset + len(line), nil
+}
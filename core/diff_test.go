@@ -417,3 +417,48 @@ func offsetOf(t *testing.T, text string, pos types.Position) int {
 
 	return offset + len(lines[pos.Line])
 }
+
+func TestApplyEdits(t *testing.T) {
+	before := "héllo\n😀 world\n"
+
+	// out of order, as a client may be sent them
+	got, err := ApplyEdits(before, []types.TextEdit{
+		{Range: types.Range{Start: types.Position{Line: 1, Character: 3}, End: types.Position{Line: 1, Character: 8}}, NewText: "there"},
+		{Range: types.Range{Start: types.Position{Line: 0, Character: 0}, End: types.Position{Line: 0, Character: 2}}, NewText: "ha"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hallo\n😀 there\n", got)
+
+	// whatever ComputeEdits produces applies back to what it was computed from
+	after := "hello\nworld\nagain"
+	edits, err := ComputeEdits(before, after)
+	require.NoError(t, err)
+	got, err = ApplyEdits(before, edits)
+	require.NoError(t, err)
+	assert.Equal(t, after, got)
+}
+
+func TestApplyEditsRejectsWhatAClientWould(t *testing.T) {
+	text := "😀\nab\n"
+	at := func(line, character int) types.Range {
+		return types.Range{Start: types.Position{Line: line, Character: character}, End: types.Position{Line: line, Character: character}}
+	}
+
+	tests := map[string][]types.TextEdit{
+		"no such line":          {{Range: at(3, 0)}},
+		"past the end of line":  {{Range: at(1, 3)}},
+		"inside surrogate pair": {{Range: at(0, 1)}},
+		"backwards": {{Range: types.Range{
+			Start: types.Position{Line: 1, Character: 2}, End: types.Position{Line: 1, Character: 0}}}},
+		"overlapping": {
+			{Range: types.Range{Start: types.Position{Line: 1, Character: 0}, End: types.Position{Line: 1, Character: 2}}},
+			{Range: at(1, 1)},
+		},
+	}
+	for name, edits := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ApplyEdits(text, edits)
+			assert.Error(t, err)
+		})
+	}
+}
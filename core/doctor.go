@@ -0,0 +1,398 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// Diagnosis explains what flint-ls makes of a document: which configs apply to
+// it and why the others do not, where and how their tools are run, and what those
+// tools made of the document when they were. It answers "why doesn't my linter
+// run" without reading the log.
+type Diagnosis struct {
+	URI        types.DocumentURI `json:"uri"`
+	LanguageID string            `json:"languageId"`
+	// the workspace root, where a tool runs when it has no root of its own
+	RootPath string            `json:"rootPath"`
+	Configs  []ConfigDiagnosis `json:"configs"`
+}
+
+// ConfigDiagnosis is one config registered for the document's language or for
+// every language.
+type ConfigDiagnosis struct {
+	// the key the config is registered under, which is the document's language ID
+	// or the wildcard
+	Language string `json:"language"`
+	// where in the list for Language the config sits
+	Index int `json:"index"`
+	// why the config does not apply to the document; empty when it does
+	Skipped string `json:"skipped,omitempty"`
+	// the lintExclude pattern that keeps the config's linter off the document
+	LintExcludedBy string `json:"lintExcludedBy,omitempty"`
+	// where the config's tools run
+	RootPath  string         `json:"rootPath,omitempty"`
+	Linter    *ToolDiagnosis `json:"linter,omitempty"`
+	Formatter *ToolDiagnosis `json:"formatter,omitempty"`
+}
+
+// ToolDiagnosis is a linter or formatter, and what a dry run of it came to.
+type ToolDiagnosis struct {
+	// the command as it is run, placeholders filled in: a shell command, or the
+	// arguments of a tool run without a shell
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// the command is the one its daemon was started with, and the document goes
+	// over the daemon's stdin
+	Daemon bool `json:"daemon,omitempty"`
+	// the program the command starts, and where on PATH it was found. Empty
+	// ExecutablePath means it was not, which for a shell command can also be a
+	// shell builtin
+	Executable     string `json:"executable,omitempty"`
+	ExecutablePath string `json:"executablePath,omitempty"`
+	// the document events a linter runs on
+	LintsOn []string `json:"lintsOn,omitempty"`
+	// everything a linter printed, or the text a formatter produced
+	Output      string             `json:"output"`
+	Diagnostics []types.Diagnostic `json:"diagnostics,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// Failed reports whether a tool failed its dry run. An executable missing from
+// PATH alone does not count: it can be a shell builtin, and a tool that is really
+// missing fails to run anyway.
+func (d Diagnosis) Failed() bool {
+	for _, c := range d.Configs {
+		for _, tool := range []*ToolDiagnosis{c.Linter, c.Formatter} {
+			if tool != nil && tool.Error != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Diagnose explains uri, which has to be open: every config that could apply to
+// it is resolved the way a run would, and each of their tools is run once over
+// the document. Nothing is published and nothing is written: a formatter's result
+// goes into the diagnosis and nowhere else.
+func (h *LangHandler) Diagnose(ctx context.Context, uri types.DocumentURI, options types.FormattingOptions) (Diagnosis, error) {
+	snap, err := h.snapshot(uri)
+	if err != nil {
+		return Diagnosis{}, err
+	}
+	f := snap.file
+
+	diagnosis := Diagnosis{URI: uri, LanguageID: f.LanguageID, RootPath: snap.rootPath}
+	languages := []string{f.LanguageID}
+	if f.LanguageID != types.Wildcard {
+		languages = append(languages, types.Wildcard)
+	}
+	for _, language := range languages {
+		for i, cfg := range snap.configs[language] {
+			diagnosis.Configs = append(diagnosis.Configs, h.diagnoseConfig(ctx, snap, language, i, cfg, options))
+		}
+	}
+
+	return diagnosis, nil
+}
+
+// diagnoseConfig resolves one config for the snapshot's document the way
+// resolveConfigs does, saying why when it does not apply, and dry runs its tools.
+func (h *LangHandler) diagnoseConfig(ctx context.Context, snap documentSnapshot, language string, index int, cfg types.Language, options types.FormattingOptions) ConfigDiagnosis {
+	f := snap.file
+	result := ConfigDiagnosis{Language: language, Index: index}
+
+	if !cfg.HasLinter() && !cfg.HasFormatter() {
+		result.Skipped = "no linter or formatter configured"
+		return result
+	}
+
+	if cfg.HasLinter() {
+		result.LintExcludedBy = cmp.Or(snap.lintExcludedBy(snap.filter.lintExclude), snap.lintExcludedBy(cfg.LintExclude))
+		if result.LintExcludedBy != "" {
+			cfg.LintCommand, cfg.LintArgs = "", nil
+		}
+	}
+	if result.LintExcludedBy != "" && !cfg.HasFormatter() {
+		result.Skipped = fmt.Sprintf("lintExclude pattern %q excludes the document, and there is no formatter", result.LintExcludedBy)
+		return result
+	}
+
+	dir := matchRootPath(f.NormalizedFilename, cfg.RootMarkers)
+	switch {
+	case dir != "":
+	case cfg.RequireMarker && len(cfg.RootMarkers) == 0:
+		result.Skipped = "requireMarker is set, but there are no rootMarkers to look for"
+		return result
+	case cfg.RequireMarker:
+		result.Skipped = fmt.Sprintf("requireMarker is set, and none of the rootMarkers %q is in a directory above the document", cfg.RootMarkers)
+		return result
+	default:
+		dir = snap.rootPath
+	}
+	result.RootPath = dir
+
+	if cfg.HasLinter() {
+		result.Linter = diagnoseLinter(ctx, h.daemons, dir, f, cfg)
+	}
+	if cfg.HasFormatter() {
+		result.Formatter = diagnoseFormatter(ctx, h.daemons, dir, f, cfg, options)
+	}
+
+	return result
+}
+
+func diagnoseLinter(ctx context.Context, daemons *daemonPool, rootPath string, f fileRef, config types.Language) *ToolDiagnosis {
+	tool := &ToolDiagnosis{Daemon: config.LintDaemon}
+	switch {
+	case config.LintDaemon:
+		tool.describeDaemon(daemonKeyFor(config.LintCommand, config.LintArgs, rootPath))
+	case len(config.LintArgs) > 0:
+		tool.Args = buildLintArgv(rootPath, f, config)
+	default:
+		tool.Command = buildLintCommandString(rootPath, f, config)
+	}
+	tool.findExecutable(rootPath, config)
+
+	for _, event := range []struct {
+		name    string
+		enabled *bool
+	}{
+		{"open", config.LintAfterOpen},
+		{"change", config.LintOnChange},
+		{"save", config.LintOnSave},
+	} {
+		if boolOrDefault(event.enabled, true) {
+			tool.LintsOn = append(tool.LintsOn, event.name)
+		}
+	}
+
+	var output strings.Builder
+	diagnostics, err := lintDocument(ctx, daemons, nil, rootPath, f, config, nil, nil, &output, nil)
+	tool.Output = output.String()
+	tool.Diagnostics = diagnostics
+	if err != nil {
+		tool.Error = err.Error()
+	}
+
+	return tool
+}
+
+func diagnoseFormatter(ctx context.Context, daemons *daemonPool, rootPath string, f fileRef, config types.Language, options types.FormattingOptions) *ToolDiagnosis {
+	tool := &ToolDiagnosis{Daemon: config.FormatDaemon}
+	switch {
+	case config.FormatDaemon:
+		tool.describeDaemon(daemonKeyFor(config.FormatCommand, config.FormatArgs, rootPath))
+	case len(config.FormatArgs) > 0:
+		tool.Args = buildFormatArgv(rootPath, f.NormalizedFilename, f.Text, options, nil, config.FormatArgs)
+	default:
+		tool.Command = buildFormatCommandString(rootPath, f.NormalizedFilename, f.Text, options, nil, config.FormatCommand)
+	}
+	tool.findExecutable(rootPath, config)
+
+	formatted, err := formatDocument(ctx, daemons, rootPath, f.NormalizedFilename, f.Text, nil, options, config)
+	tool.Output = formatted
+	if err != nil {
+		tool.Error = err.Error()
+	}
+
+	return tool
+}
+
+func (t *ToolDiagnosis) describeDaemon(key daemonKey) {
+	if key.argv {
+		t.Args = strings.Split(key.command, "\x00")
+	} else {
+		t.Command = key.command
+	}
+}
+
+// findExecutable fills in the program the tool's command starts and where it is,
+// looked up on the PATH the tool will have.
+func (t *ToolDiagnosis) findExecutable(dir string, config types.Language) {
+	if len(t.Args) > 0 {
+		t.Executable = t.Args[0]
+	} else {
+		t.Executable = shellCommandName(t.Command)
+	}
+	if t.Executable == "" {
+		return
+	}
+
+	env := append(inheritedEnv(config.EnvAllowlist), config.Env...)
+	if path, err := lookExecutable(t.Executable, dir, env); err == nil {
+		t.ExecutablePath = path
+	}
+}
+
+// reAssignment matches a variable assignment, which a shell command may start
+// with ahead of the program it runs.
+var reAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// shellCommandName makes a best guess at the program a shell command starts: its
+// first word that is not a variable assignment, with its quotes taken off. A
+// command that starts with anything cleverer than that -- a subshell, a pipeline
+// into a function -- may well be guessed wrong, which the diagnosis can live with.
+func shellCommandName(command string) string {
+	rest := command
+	for {
+		raw, word, tail := nextShellWord(rest)
+		if raw == "" || !reAssignment.MatchString(raw) {
+			return word
+		}
+		rest = tail
+	}
+}
+
+// nextShellWord splits the first word off s, both as written and with its quotes
+// taken off.
+func nextShellWord(s string) (raw, word, rest string) {
+	s = strings.TrimLeft(s, " \t\n")
+
+	var b strings.Builder
+	var quote byte
+	i := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		if quote == 0 && (c == ' ' || c == '\t' || c == '\n') {
+			break
+		}
+		switch {
+		case c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote = c
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return s[:i], b.String(), s[i:]
+}
+
+// lookExecutable is exec.LookPath for a process whose environment is env and
+// whose working directory is dir, rather than flint-ls' own.
+func lookExecutable(name, dir string, env []string) (string, error) {
+	if strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return exec.LookPath(name)
+	}
+
+	// the last assignment wins, as it does for the process
+	var path string
+	for _, kv := range slices.Backward(env) {
+		key, value, _ := strings.Cut(kv, "=")
+		if strings.EqualFold(key, "PATH") {
+			path = value
+			break
+		}
+	}
+
+	for _, d := range filepath.SplitList(path) {
+		if d == "" {
+			d = "."
+		}
+		if !filepath.IsAbs(d) {
+			d = filepath.Join(dir, d)
+		}
+		if found, err := exec.LookPath(filepath.Join(d, name)); err == nil {
+			return found, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", name, exec.ErrNotFound)
+}
+
+// Report renders the diagnosis for a person to read.
+func (d Diagnosis) Report() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "document:  %s\n", d.URI)
+	fmt.Fprintf(&b, "language:  %s\n", d.LanguageID)
+	fmt.Fprintf(&b, "workspace: %s\n", d.RootPath)
+
+	if len(d.Configs) == 0 {
+		fmt.Fprintf(&b, "\nnothing is configured for this document: there is no config for %q, and none for every language (%q)\n", d.LanguageID, types.Wildcard)
+	}
+
+	for _, c := range d.Configs {
+		fmt.Fprintf(&b, "\n%s[%d]:", c.Language, c.Index)
+		if c.Skipped != "" {
+			fmt.Fprintf(&b, " skipped: %s\n", c.Skipped)
+			continue
+		}
+		fmt.Fprintf(&b, " runs in %s\n", c.RootPath)
+
+		if c.LintExcludedBy != "" {
+			fmt.Fprintf(&b, "  linter:      not run, lintExclude pattern %q excludes the document\n", c.LintExcludedBy)
+		}
+		if c.Linter != nil {
+			b.WriteString("  linter:\n")
+			c.Linter.report(&b, true)
+		}
+		if c.Formatter != nil {
+			b.WriteString("  formatter:\n")
+			c.Formatter.report(&b, false)
+		}
+	}
+
+	return b.String()
+}
+
+func (t *ToolDiagnosis) report(b *strings.Builder, linter bool) {
+	command := t.Command
+	if len(t.Args) > 0 {
+		command = fmt.Sprintf("%q", t.Args)
+	}
+	if t.Daemon {
+		command += " (daemon)"
+	}
+	fmt.Fprintf(b, "    command:     %s\n", command)
+
+	switch {
+	case t.Executable == "":
+	case t.ExecutablePath != "":
+		fmt.Fprintf(b, "    executable:  %s\n", t.ExecutablePath)
+	default:
+		fmt.Fprintf(b, "    executable:  %s is not on PATH\n", t.Executable)
+	}
+
+	switch {
+	case !linter:
+	case len(t.LintsOn) > 0:
+		fmt.Fprintf(b, "    lints on:    %s\n", strings.Join(t.LintsOn, ", "))
+	default:
+		b.WriteString("    lints on:    nothing, lintAfterOpen, lintOnChange and lintOnSave are all off\n")
+	}
+
+	if t.Error != "" {
+		fmt.Fprintf(b, "    error:       %s\n", t.Error)
+	}
+
+	b.WriteString("    output:")
+	if t.Output == "" {
+		b.WriteString("      (none)\n")
+	} else {
+		b.WriteString("\n")
+		for line := range strings.Lines(t.Output) {
+			fmt.Fprintf(b, "      | %s\n", strings.TrimRight(line, "\r\n"))
+		}
+	}
+
+	if linter {
+		fmt.Fprintf(b, "    diagnostics: %d\n", len(t.Diagnostics))
+		for _, d := range t.Diagnostics {
+			fmt.Fprintf(b, "      %d:%d: %s\n", d.Range.Start.Line+1, d.Range.Start.Character+1, d.Message)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestDiagnose(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tools below are POSIX ones")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	uri := ParseLocalFileToURI(file)
+
+	lintOnChange := false
+	h := NewHandler(map[string][]types.Language{
+		"test": {
+			{
+				LintCommand:        "echo 1:problem; echo not a finding",
+				LintStdin:          true,
+				LintIgnoreExitCode: true,
+				LintFormats:        []string{"%l:%m"},
+				LintOnChange:       &lintOnChange,
+			},
+			{FormatArgs: []string{"tr", "a-z", "A-Z"}},
+			{LintCommand: "never runs", RequireMarker: true, RootMarkers: []string{"no-such-marker"}},
+			{Prefix: "nothing to run"},
+		},
+		types.Wildcard: {{LintArgs: []string{"flint-ls-no-such-tool"}}},
+		"other":        {{LintCommand: "not for this document"}},
+	})
+	t.Cleanup(h.Close)
+	_, err := h.Initialize(types.InitializeParams{RootURI: ParseLocalFileToURI(dir)})
+	require.NoError(t, err)
+	require.NoError(t, h.OpenFile(uri, "test", 1, "hello\n"))
+
+	d, err := h.Diagnose(t.Context(), uri, types.FormattingOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "test", d.LanguageID)
+	assert.Equal(t, dir, d.RootPath)
+	require.Len(t, d.Configs, 5, "every config for the language and for every language, and no other")
+
+	linter := d.Configs[0]
+	assert.Equal(t, dir, linter.RootPath)
+	require.NotNil(t, linter.Linter)
+	assert.Nil(t, linter.Formatter)
+	assert.Equal(t, "echo 1:problem; echo not a finding", linter.Linter.Command)
+	assert.Equal(t, "echo", linter.Linter.Executable)
+	assert.NotEmpty(t, linter.Linter.ExecutablePath)
+	assert.Equal(t, []string{"open", "save"}, linter.Linter.LintsOn)
+	assert.Equal(t, "1:problem\nnot a finding\n", linter.Linter.Output, "the output is all of it, not just what parsed")
+	require.Len(t, linter.Linter.Diagnostics, 1)
+	assert.Equal(t, "problem", linter.Linter.Diagnostics[0].Message)
+	assert.Empty(t, linter.Linter.Error)
+
+	formatter := d.Configs[1]
+	require.NotNil(t, formatter.Formatter)
+	assert.Equal(t, []string{"tr", "a-z", "A-Z"}, formatter.Formatter.Args)
+	assert.Equal(t, "HELLO\n", formatter.Formatter.Output)
+
+	assert.Contains(t, d.Configs[2].Skipped, "requireMarker")
+	assert.Nil(t, d.Configs[2].Linter, "a skipped config does not run")
+	assert.Contains(t, d.Configs[3].Skipped, "no linter or formatter")
+
+	wildcard := d.Configs[4]
+	assert.Equal(t, types.Wildcard, wildcard.Language)
+	require.NotNil(t, wildcard.Linter)
+	assert.Equal(t, []string{"flint-ls-no-such-tool", file}, wildcard.Linter.Args)
+	assert.Empty(t, wildcard.Linter.ExecutablePath)
+	assert.NotEmpty(t, wildcard.Linter.Error)
+
+	assert.True(t, d.Failed())
+	assert.Contains(t, d.Report(), "flint-ls-no-such-tool is not on PATH")
+
+	// nothing of the dry run reaches the document
+	snap, err := h.snapshot(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", snap.file.Text)
+}
+
+func TestDiagnoseNeedsAnOpenDocument(t *testing.T) {
+	h := NewHandler(nil)
+
+	_, err := h.Diagnose(t.Context(), ParseLocalFileToURI(filepath.Join(t.TempDir(), "a.txt")), nil)
+	assert.Error(t, err)
+}
+
+func TestDiagnoseLintExclude(t *testing.T) {
+	dir := t.TempDir()
+	uri := ParseLocalFileToURI(filepath.Join(dir, "gen", "a.txt"))
+
+	h := NewHandler(map[string][]types.Language{"test": {
+		{LintCommand: "never runs", LintExclude: []string{"gen/"}},
+		{LintCommand: "never runs", FormatCommand: "cat"},
+	}})
+	t.Cleanup(h.Close)
+	_, err := h.Initialize(types.InitializeParams{RootURI: ParseLocalFileToURI(dir)})
+	require.NoError(t, err)
+	h.UpdateConfiguration(&types.Config{LintExclude: []string{"*.txt"}})
+	require.NoError(t, h.OpenFile(uri, "test", 1, "hello\n"))
+
+	d, err := h.Diagnose(t.Context(), uri, types.FormattingOptions{})
+	require.NoError(t, err)
+	require.Len(t, d.Configs, 2)
+
+	assert.Equal(t, "*.txt", d.Configs[0].LintExcludedBy, "the top level patterns go first")
+	assert.Contains(t, d.Configs[0].Skipped, "lintExclude")
+	assert.Nil(t, d.Configs[0].Linter)
+
+	assert.Equal(t, "*.txt", d.Configs[1].LintExcludedBy)
+	assert.Empty(t, d.Configs[1].Skipped, "the formatter still applies")
+	assert.Nil(t, d.Configs[1].Linter)
+	assert.NotNil(t, d.Configs[1].Formatter)
+}
+
+func TestShellCommandName(t *testing.T) {
+	tests := map[string]string{
+		"golangci-lint run ${INPUT}":        "golangci-lint",
+		"GOFLAGS=-mod=mod A=1 go vet ./...": "go",
+		"'/opt/my tools/lint' --fast":       "/opt/my tools/lint",
+		`"eslint" --stdin`:                  "eslint",
+		"":                                  "",
+	}
+
+	for command, want := range tests {
+		assert.Equal(t, want, shellCommandName(command), command)
+	}
+}
+
+func TestLookExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("an executable is a matter of extensions rather than mode bits there")
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	require.NoError(t, os.Mkdir(bin, 0o755))
+	tool := filepath.Join(bin, "tool")
+	require.NoError(t, os.WriteFile(tool, []byte("#!/bin/sh\n"), 0o755))
+
+	found, err := lookExecutable("tool", dir, []string{"PATH=/nowhere", "PATH=" + bin})
+	require.NoError(t, err)
+	assert.Equal(t, tool, found, "the last PATH is the one the tool gets")
+
+	found, err = lookExecutable("tool", dir, []string{"PATH=bin"})
+	require.NoError(t, err)
+	assert.Equal(t, tool, found, "a relative PATH entry is relative to where the tool runs")
+
+	found, err = lookExecutable("./bin/tool", dir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, tool, found)
+
+	_, err = lookExecutable("tool", dir, []string{"PATH=/nowhere"})
+	assert.Error(t, err)
+}
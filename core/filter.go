@@ -0,0 +1,214 @@
+package core
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// diagnosticFilter is what the configuration says about the diagnostics of every
+// language: which documents are not linted at all, and how much of what the
+// linters find in the others is published. Its zero value filters nothing.
+type diagnosticFilter struct {
+	lintExclude    []string
+	minSeverity    types.DiagnosticSeverity
+	maxDiagnostics int
+	deduplicate    bool
+	precedence     []string
+	duplicateCodes map[string]string
+}
+
+// update takes in what config says about the filter, leaving alone what it says
+// nothing about.
+func (f *diagnosticFilter) update(config *types.Config) {
+	if config.LintExclude != nil {
+		f.lintExclude = config.LintExclude
+	}
+	if config.MinSeverity != nil {
+		f.minSeverity = *config.MinSeverity
+	}
+	if config.MaxDiagnostics != nil {
+		f.maxDiagnostics = *config.MaxDiagnostics
+	}
+	if config.DeduplicateDiagnostics != nil {
+		f.deduplicate = *config.DeduplicateDiagnostics
+	}
+	if config.SourcePrecedence != nil {
+		f.precedence = config.SourcePrecedence
+	}
+	if config.DuplicateCodes != nil {
+		f.duplicateCodes = config.DuplicateCodes
+	}
+}
+
+// apply publishes each finding once when deduplicate is set, drops the
+// diagnostics less severe than minSeverity and, of those left, keeps the
+// maxDiagnostics most severe ones. Diagnostics of the same severity keep the
+// order they came in, so when some of them have to go it is those of the linters
+// published last.
+func (f diagnosticFilter) apply(diagnostics []types.Diagnostic) []types.Diagnostic {
+	if f.deduplicate {
+		diagnostics = f.deduplicated(diagnostics)
+	}
+
+	if f.minSeverity > 0 {
+		kept := make([]types.Diagnostic, 0, len(diagnostics))
+		for _, d := range diagnostics {
+			if severityOf(d) <= f.minSeverity {
+				kept = append(kept, d)
+			}
+		}
+		diagnostics = kept
+	}
+
+	if f.maxDiagnostics > 0 && len(diagnostics) > f.maxDiagnostics {
+		diagnostics = slices.Clone(diagnostics)
+		slices.SortStableFunc(diagnostics, func(a, b types.Diagnostic) int { return int(severityOf(a)) - int(severityOf(b)) })
+		diagnostics = diagnostics[:f.maxDiagnostics]
+	}
+
+	return diagnostics
+}
+
+// duplicateKey is what tells one finding from another: where it is, and either
+// what it says or its code.
+type duplicateKey struct {
+	rng  types.Range
+	what string
+}
+
+// deduplicated keeps one of the diagnostics that report the same finding: at
+// the same range, with the same message once normalizeMessage is done with it or
+// with the same code from the same source, or from any source once
+// duplicateCodes is done with it. Of those, the one whose source
+// comes first in precedence is kept, in the place of the first of them, and the
+// first of them if their sources rank the same. Two diagnostics need not have a
+// key in common with each other to be taken for one: each is matched against
+// the keys of all those taken for the one it joins.
+func (f diagnosticFilter) deduplicated(diagnostics []types.Diagnostic) []types.Diagnostic {
+	kept := make([]types.Diagnostic, 0, len(diagnostics))
+	seen := make(map[duplicateKey]int)
+	for _, d := range diagnostics {
+		keys := f.duplicateKeys(d)
+
+		i := -1
+		for _, key := range keys {
+			if at, ok := seen[key]; ok {
+				i = at
+				break
+			}
+		}
+		switch {
+		case i < 0:
+			i = len(kept)
+			kept = append(kept, d)
+		case f.rank(d) < f.rank(kept[i]):
+			kept[i] = d
+		}
+
+		for _, key := range keys {
+			if _, ok := seen[key]; !ok {
+				seen[key] = i
+			}
+		}
+	}
+
+	return kept
+}
+
+// duplicateKeys are the keys d is matched by. A code only means something to the
+// linter that reports it -- two tools numbering their rules may well both have a
+// 42 -- so it is matched within its source, unless duplicateCodes names it.
+func (f diagnosticFilter) duplicateKeys(d types.Diagnostic) []duplicateKey {
+	keys := []duplicateKey{{rng: d.Range, what: "message:" + normalizeMessage(d.Message)}}
+	if d.Code != nil {
+		code := d.Code.String()
+		if same, ok := f.duplicateCodes[code]; ok {
+			keys = append(keys, duplicateKey{rng: d.Range, what: "code:" + same})
+		} else if slices.Contains(slices.Collect(maps.Values(f.duplicateCodes)), code) {
+			keys = append(keys, duplicateKey{rng: d.Range, what: "code:" + code})
+		} else {
+			var source string
+			if d.Source != nil {
+				source = *d.Source
+			}
+			keys = append(keys, duplicateKey{rng: d.Range, what: "code:" + source + ":" + code})
+		}
+	}
+
+	return keys
+}
+
+// rank is where the source of d comes in precedence: the lower, the more it is
+// preferred.
+func (f diagnosticFilter) rank(d types.Diagnostic) int {
+	if d.Source != nil {
+		if i := slices.Index(f.precedence, *d.Source); i >= 0 {
+			return i
+		}
+	}
+
+	return len(f.precedence)
+}
+
+// normalizeMessage takes out of message what two linters word differently when
+// they say the same: the prefix a config puts in front of it, case, quotes,
+// runs of spaces and a closing period.
+func normalizeMessage(message string) string {
+	if strings.HasPrefix(message, "[") {
+		if end := strings.Index(message, "] "); end > 0 {
+			message = message[end+2:]
+		}
+	}
+
+	message = strings.Map(func(r rune) rune {
+		if strings.ContainsRune("'\"`‘’“”", r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, message)
+
+	return strings.TrimSuffix(strings.Join(strings.Fields(message), " "), ".")
+}
+
+// severityOf is how severe d is. One without a severity is left for the client
+// to judge, and clients take it for an error.
+func severityOf(d types.Diagnostic) types.DiagnosticSeverity {
+	if d.Severity == 0 {
+		return types.DiagError
+	}
+	return d.Severity
+}
+
+// excludedBy returns the first of patterns that matches fname, relative to the
+// workspace root, or one of the directories it is in, or "" if none does. So, as
+// in a .gitignore, "vendor" excludes everything in any directory of that name and
+// "/vendor" only what is in the one at the root. A document outside the root is
+// matched by its whole path, so that a pattern starting with ** still excludes
+// it.
+func excludedBy(rootPath, fname string, patterns []string) string {
+	if len(patterns) == 0 {
+		return ""
+	}
+
+	name, ok := relativeTo(rootPath, fname)
+	if !ok {
+		name = strings.TrimPrefix(filepath.ToSlash(fname), "/")
+	}
+
+	elements := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		trimmed := strings.TrimSuffix(pattern, "/")
+		for i := range elements {
+			if matchGlob(trimmed, strings.Join(elements[:i+1], "/")) {
+				return pattern
+			}
+		}
+	}
+
+	return ""
+}
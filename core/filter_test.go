@@ -0,0 +1,301 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestDiagnosticFilterApply(t *testing.T) {
+	diagnostics := []types.Diagnostic{
+		{Message: "hint", Severity: types.DiagHint},
+		{Message: "warning", Severity: types.DiagWarning},
+		{Message: "unset"},
+		{Message: "information", Severity: types.DiagInformation},
+		{Message: "error", Severity: types.DiagError},
+	}
+
+	tests := []struct {
+		name   string
+		filter diagnosticFilter
+		want   []string
+	}{
+		{"nothing to filter", diagnosticFilter{}, []string{"hint", "warning", "unset", "information", "error"}},
+		{"the less severe are dropped", diagnosticFilter{minSeverity: types.DiagWarning}, []string{"warning", "unset", "error"}},
+		{"the most severe are kept, in the order they came", diagnosticFilter{maxDiagnostics: 3}, []string{"unset", "error", "warning"}},
+		{"under the limit nothing moves", diagnosticFilter{maxDiagnostics: 5}, []string{"hint", "warning", "unset", "information", "error"}},
+		{"both", diagnosticFilter{minSeverity: types.DiagInformation, maxDiagnostics: 1}, []string{"unset"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := make([]string, 0)
+			for _, d := range tt.filter.apply(diagnostics) {
+				messages = append(messages, d.Message)
+			}
+			assert.Equal(t, tt.want, messages)
+		})
+	}
+
+	assert.Equal(t, "hint", diagnostics[0].Message, "what was passed in is left alone")
+}
+
+func TestExcludedBy(t *testing.T) {
+	root := filepath.FromSlash("/work")
+	tests := []struct {
+		name     string
+		fname    string
+		patterns []string
+		want     string
+	}{
+		{"no patterns", "/work/a.go", nil, ""},
+		{"a file name anywhere", "/work/x/zz_generated.go", []string{"*.pb.go", "zz_generated.go"}, "zz_generated.go"},
+		{"a directory name anywhere", "/work/x/node_modules/y/a.js", []string{"node_modules"}, "node_modules"},
+		{"a trailing slash is the same", "/work/x/node_modules/a.js", []string{"node_modules/"}, "node_modules/"},
+		{"a leading slash is the root", "/work/x/vendor/a.go", []string{"/vendor"}, ""},
+		{"at the root", "/work/vendor/a.go", []string{"/vendor"}, "/vendor"},
+		{"a path", "/work/api/gen/a.go", []string{"api/**/*.go"}, "api/**/*.go"},
+		{"a document outside the root", "/elsewhere/vendor/a.go", []string{"**/vendor/**"}, "**/vendor/**"},
+		{"nothing matches", "/work/a.go", []string{"vendor", "*.js"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, excludedBy(root, filepath.FromSlash(tt.fname), tt.patterns))
+		})
+	}
+}
+
+func TestLintExclude(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "vendor"), 0o700))
+
+	h := NewHandler(map[string][]types.Language{"go": {
+		{LintCommand: "vet", FormatCommand: "gofmt", LintExclude: []string{"*_test.go"}},
+		{LintCommand: "staticcheck"},
+	}})
+	t.Cleanup(h.Close)
+	_, err := h.Initialize(types.InitializeParams{RootURI: ParseLocalFileToURI(dir)})
+	require.NoError(t, err)
+	h.UpdateConfiguration(&types.Config{LintExclude: []string{"vendor"}})
+
+	open := func(name string) types.DocumentURI {
+		uri := ParseLocalFileToURI(filepath.Join(dir, name))
+		require.NoError(t, h.OpenFile(uri, "go", 1, ""))
+		return uri
+	}
+	resolve := func(uri types.DocumentURI, keep func(types.Language) bool) []resolvedConfig {
+		snap, err := h.snapshot(uri)
+		require.NoError(t, err)
+		return snap.resolveConfigs(keep)
+	}
+	linters := func(uri types.DocumentURI) []string {
+		commands := make([]string, 0)
+		for _, cfg := range resolve(uri, types.Language.HasLinter) {
+			commands = append(commands, cfg.LintCommand)
+		}
+		return commands
+	}
+
+	assert.Equal(t, []string{"vet", "staticcheck"}, linters(open("a.go")))
+	assert.Equal(t, []string{"staticcheck"}, linters(open("a_test.go")), "a config's own patterns exclude its linter alone")
+
+	vendored := open(filepath.Join("vendor", "a.go"))
+	assert.Empty(t, linters(vendored))
+	assert.False(t, h.HasLinters(vendored, types.EventTypeOpen|types.EventTypeChange|types.EventTypeSave))
+	assert.Len(t, resolve(vendored, types.Language.HasFormatter), 1, "the formatter still applies")
+
+	h.UpdateConfiguration(&types.Config{LintDebounce: 1})
+	assert.Empty(t, linters(vendored), "a config that says nothing about lintExclude keeps it")
+	h.UpdateConfiguration(&types.Config{LintExclude: []string{}})
+	assert.Equal(t, []string{"vet", "staticcheck"}, linters(vendored))
+}
+
+func TestPublishedDiagnosticsAreFiltered(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	h, uri := newStoreTestHandler(t,
+		types.Language{
+			LintCommand:        "printf '%s\\n' 1:E:error 1:I:information",
+			LintFormats:        []string{"%l:%t:%m"},
+			LintStdin:          true,
+			LintIgnoreExitCode: true,
+		},
+		types.Language{
+			LintCommand:        "printf '%s\\n' 2:W:warning 2:N:hint",
+			LintFormats:        []string{"%l:%t:%m"},
+			LintStdin:          true,
+			LintIgnoreExitCode: true,
+		})
+
+	warning, unset := types.DiagWarning, types.DiagnosticSeverity(0)
+	one, unlimited := 1, 0
+
+	h.UpdateConfiguration(&types.Config{MinSeverity: &warning})
+	assert.Equal(t, []string{"error", "warning"}, lastPublishedMessages(t, h, uri, types.EventTypeChange))
+
+	h.UpdateConfiguration(&types.Config{MaxDiagnostics: &one})
+	assert.Equal(t, []string{"error"}, lastPublishedMessages(t, h, uri, types.EventTypeChange))
+
+	h.UpdateConfiguration(&types.Config{LintDebounce: 1})
+	assert.Equal(t, []string{"error"}, lastPublishedMessages(t, h, uri, types.EventTypeChange),
+		"a config that says nothing about the filter keeps it")
+
+	h.UpdateConfiguration(&types.Config{MinSeverity: &unset, MaxDiagnostics: &unlimited})
+	assert.Equal(t, []string{"error", "hint", "information", "warning"}, lastPublishedMessages(t, h, uri, types.EventTypeChange),
+		"0 turns either off again")
+
+	assert.Len(t, h.diagnostics.documents[uri].own["printf '%s\\n' 2:W:warning 2:N:hint#0"], 2,
+		"what is kept for the next publish is all of it")
+}
+
+func TestDeduplicated(t *testing.T) {
+	at := func(line int) types.Range {
+		return types.Range{Start: types.Position{Line: line}, End: types.Position{Line: line, Character: 4}}
+	}
+	finding := func(source string, line int, code *types.DiagnosticCode, message string) types.Diagnostic {
+		return types.Diagnostic{Range: at(line), Source: &source, Code: code, Message: message}
+	}
+
+	tests := []struct {
+		name        string
+		filter      diagnosticFilter
+		diagnostics []types.Diagnostic
+		want        []string
+	}{
+		{
+			"the same message, worded a little differently",
+			diagnosticFilter{},
+			[]types.Diagnostic{
+				finding("flake8", 0, nil, "[flake8] 'os' imported but unused"),
+				finding("ruff", 0, nil, "`os`  Imported but unused."),
+			},
+			[]string{"flake8"},
+		},
+		{
+			"the same code from the same source",
+			diagnosticFilter{},
+			[]types.Diagnostic{
+				finding("ruff", 0, types.StringCode("E501"), "Line too long (90 > 79)"),
+				finding("ruff", 0, types.StringCode("E501"), "Line too long (90 > 88)"),
+			},
+			[]string{"ruff"},
+		},
+		{
+			"the same code from two sources is not enough",
+			diagnosticFilter{},
+			[]types.Diagnostic{
+				finding("gcc", 0, types.IntCode(42), "unused variable"),
+				finding("shellcheck", 0, types.IntCode(42), "quote this to prevent word splitting"),
+			},
+			[]string{"gcc", "shellcheck"},
+		},
+		{
+			"the same code from two sources, when duplicateCodes says so",
+			diagnosticFilter{duplicateCodes: map[string]string{"E501": "E501"}},
+			[]types.Diagnostic{
+				finding("flake8", 0, types.StringCode("E501"), "line too long (90 > 79 characters)"),
+				finding("ruff", 0, types.StringCode("E501"), "Line too long (90 > 88)"),
+			},
+			[]string{"flake8"},
+		},
+		{
+			"codes mapped to one another",
+			diagnosticFilter{duplicateCodes: map[string]string{"6133": "no-unused-vars"}},
+			[]types.Diagnostic{
+				finding("tsc", 0, types.IntCode(6133), "'x' is declared but its value is never read."),
+				finding("eslint", 0, types.StringCode("no-unused-vars"), "'x' is assigned a value but never used."),
+			},
+			[]string{"tsc"},
+		},
+		{
+			"the preferred source is kept, where the first one was",
+			diagnosticFilter{precedence: []string{"ruff", "flake8"}},
+			[]types.Diagnostic{
+				finding("mypy", 0, nil, "something else"),
+				finding("pylint", 1, types.StringCode("E501"), "line too long"),
+				finding("flake8", 1, types.StringCode("E501"), "line too long"),
+				finding("ruff", 1, types.StringCode("E501"), "line too long"),
+			},
+			[]string{"mypy", "ruff"},
+		},
+		{
+			"one that shares a key with either of those taken for one",
+			diagnosticFilter{duplicateCodes: map[string]string{"X1": "X1"}},
+			[]types.Diagnostic{
+				finding("a", 0, types.StringCode("X1"), "first wording"),
+				finding("b", 0, types.StringCode("X1"), "second wording"),
+				finding("c", 0, nil, "second wording"),
+			},
+			[]string{"a"},
+		},
+		{
+			"different ranges are different findings",
+			diagnosticFilter{},
+			[]types.Diagnostic{
+				finding("flake8", 0, types.StringCode("E501"), "line too long"),
+				finding("ruff", 1, types.StringCode("E501"), "line too long"),
+			},
+			[]string{"flake8", "ruff"},
+		},
+		{
+			"different codes and messages are different findings",
+			diagnosticFilter{},
+			[]types.Diagnostic{
+				finding("flake8", 0, types.StringCode("E501"), "line too long"),
+				finding("ruff", 0, types.StringCode("F401"), "unused import"),
+			},
+			[]string{"flake8", "ruff"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := make([]string, 0)
+			for _, d := range tt.filter.deduplicated(tt.diagnostics) {
+				sources = append(sources, *d.Source)
+			}
+			assert.Equal(t, tt.want, sources)
+		})
+	}
+}
+
+func TestDiagnosticsAreDeduplicatedAcrossLinters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint commands below are written as POSIX shell commands")
+	}
+
+	linter := func(source, output string) types.Language {
+		return types.Language{
+			LintCommand:        "echo " + output,
+			LintFormats:        []string{"%l:%c: %m"},
+			LintStdin:          true,
+			LintIgnoreExitCode: true,
+			LintSource:         source,
+			LintCodePattern:    `^(\w+) `,
+		}
+	}
+	h, uri := newStoreTestHandler(t,
+		linter("flake8", "'1:1: F401 os imported but unused'"),
+		linter("ruff", "'1:1: F401 os imported but unused'"))
+
+	assert.Equal(t, []string{"os imported but unused", "os imported but unused"}, lastPublishedMessages(t, h, uri, types.EventTypeChange),
+		"nothing is deduplicated unless asked to")
+
+	on := true
+	h.UpdateConfiguration(&types.Config{DeduplicateDiagnostics: &on, SourcePrecedence: []string{"ruff"}})
+	pd, err := h.getAllPublishDiagnosticsParamsForUriWithEvent(t, uri, types.EventTypeChange)
+	require.NoError(t, err)
+	require.NotEmpty(t, pd)
+	published := pd[len(pd)-1].Diagnostics
+	require.Len(t, published, 1)
+	assert.Equal(t, "ruff", *published[0].Source)
+}
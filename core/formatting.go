@@ -1,11 +1,14 @@
 package core
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/konradmalik/flint-ls/logs"
@@ -20,24 +23,110 @@ var (
 	reEquals = regexp.MustCompile(`\$\{([^=}]+)=([^}]+)\}`)
 )
 
-// RunAllFormatters runs every configured formatter for uri in sequence, each
-// one fed the previous one's output, and returns the edits that turn the
-// document into the final result.
+// RunAllFormatters runs the configured formatters for uri and returns the edits
+// that turn the document into the final result. Which formatters run, and what a
+// failing one does to the run, is up to the language's format mode: by default
+// every formatter runs in sequence, each one fed the previous one's output.
 func (h *LangHandler) RunAllFormatters(
 	ctx context.Context, reporter Reporter, uri types.DocumentURI, rng *types.Range,
 	options types.FormattingOptions) ([]types.TextEdit, error) {
+	return h.runFormatters(ctx, reporter, uri, rng, options,
+		func(cfg types.Language) bool { return cfg.HasFormatter() })
+}
+
+// RunFormatter is RunAllFormatters with only the formatter called name, which is
+// its command as configured or the program that command runs. It is an error for
+// the document to have no such formatter.
+func (h *LangHandler) RunFormatter(
+	ctx context.Context, reporter Reporter, uri types.DocumentURI, rng *types.Range,
+	options types.FormattingOptions, name string) ([]types.TextEdit, error) {
+	keep := func(cfg types.Language) bool { return cfg.HasFormatter() && isFormatterCalled(cfg, name) }
+
+	snap, err := h.snapshot(uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(snap.resolveConfigs(keep)) == 0 {
+		return nil, fmt.Errorf("no formatter called %q for LanguageID: %s", name, snap.file.LanguageID)
+	}
+
+	return h.runFormatters(ctx, reporter, uri, rng, options, keep)
+}
+
+// RunOnTypeFormatters formats the document after the user typed ch, with the
+// cursor now at pos. Only the formatters that asked for ch run, and only the
+// edits around the cursor are returned: the user is in the middle of typing, and
+// reformatting the rest of the file under them would be a surprise at best.
+//
+// A formatter that can format a range is asked for the line the cursor is on and
+// the one before it, which is where typing a newline or a closing brace leaves
+// the text that wants formatting. Any other formatter sees the whole document,
+// and its edits elsewhere are dropped.
+func (h *LangHandler) RunOnTypeFormatters(
+	ctx context.Context, reporter Reporter, uri types.DocumentURI, pos types.Position, ch string,
+	options types.FormattingOptions) ([]types.TextEdit, error) {
+	triggered := func(cfg types.Language) bool {
+		return cfg.HasFormatter() && slices.Contains(cfg.FormatOnTypeTriggers, ch)
+	}
+	snap, err := h.snapshot(uri)
+	if err != nil {
+		return nil, err
+	}
+	if len(snap.resolveConfigs(triggered)) == 0 {
+		// the client sends every trigger character any formatter asked for, and
+		// one no formatter of this document asked for is not worth a warning
+		return nil, nil
+	}
+
+	firstLine := max(pos.Line-1, 0)
+	rng := &types.Range{
+		Start: types.Position{Line: firstLine, Character: 0},
+		End:   pos,
+	}
+
+	edits, err := h.runFormatters(ctx, reporter, uri, rng, options, triggered)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(edits, func(e types.TextEdit) bool {
+		return !editTouchesLines(e, firstLine, pos.Line)
+	}), nil
+}
+
+// editTouchesLines reports whether e changes anything on lines first to last. The
+// edits ComputeEdits produces replace whole lines, so one ending at the start of a
+// line leaves that line alone -- unless it is an insertion, which lands right there.
+func editTouchesLines(e types.TextEdit, first, last int) bool {
+	start, end := e.Range.Start.Line, e.Range.End.Line
+	if e.Range.End.Character == 0 && end > start {
+		end--
+	}
+	return start <= last && end >= first
+}
+
+// runFormatters is the formatting run shared by every kind of formatting request.
+// keep picks the formatters the request is for.
+func (h *LangHandler) runFormatters(
+	ctx context.Context, reporter Reporter, uri types.DocumentURI, rng *types.Range,
+	options types.FormattingOptions, keep func(types.Language) bool) ([]types.TextEdit, error) {
 	snap, err := h.snapshot(uri)
 	if err != nil {
 		return nil, err
 	}
 	f := snap.file
 
-	configs := snap.resolveConfigs(func(cfg types.Language) bool { return cfg.FormatCommand != "" })
+	configs := snap.resolveConfigs(keep)
 	if len(configs) == 0 {
 		logs.Log.Logf(logs.Warn, "no matching format configs for LanguageID: %v", f.LanguageID)
 		return nil, nil
 	}
 
+	mode, err := formatModeOf(configs)
+	if err != nil {
+		return nil, err
+	}
+
 	progressToken := types.NewProgressToken()
 	reporter.Progress(ctx, types.ProgressParams{
 		Token: progressToken,
@@ -54,22 +143,37 @@ func (h *LangHandler) RunAllFormatters(
 	formattedText := originalText
 	formatted := false
 
-	errors := make([]string, 0)
+	var failures []FormatterFailure
 	for _, config := range configs {
-		newText, err := formatDocument(ctx, config.rootPath, f.NormalizedFilename, formattedText, rng, options, config.Language)
+		var newText string
+		if config.FormatChangedLinesOnly && rng == nil {
+			// a request for a range has already said which lines to format
+			newText, err = formatChangedLines(ctx, h.daemons, &h.bases, config.rootPath, f.NormalizedFilename, formattedText, options, config.Language)
+		} else {
+			newText, err = formatDocument(ctx, h.daemons, config.rootPath, f.NormalizedFilename, formattedText, rng, options, config.Language)
+		}
 
 		if err != nil {
-			errors = append(errors, err.Error())
 			logs.Log.Logln(logs.Error, err.Error())
+			failures = append(failures, FormatterFailure{Command: formatterName(config.Language), Err: err})
+			if mode == types.FormatModeStrict {
+				// what the formatters before this one produced is exactly the partial
+				// result strict mode exists to keep from the client
+				return nil, &FormatError{LanguageID: f.LanguageID, Mode: mode, Failures: failures}
+			}
 			continue
 		}
 
 		formatted = true
 		formattedText = newText
+
+		if mode == types.FormatModeFirst {
+			break
+		}
 	}
 
 	if !formatted {
-		return nil, fmt.Errorf("could not format for LanguageID: %s. All errors: %v", f.LanguageID, errors)
+		return nil, &FormatError{LanguageID: f.LanguageID, Mode: mode, Failures: failures}
 	}
 
 	// the edits below are a diff against the text the formatters started from, so
@@ -86,14 +190,86 @@ func (h *LangHandler) RunAllFormatters(
 	return ComputeEdits(originalText, formattedText)
 }
 
+// FormatError reports a formatting run that produced nothing the client can
+// use: every formatter failed, or -- in strict mode -- one of them did. It keeps
+// each failure on its own, so a caller can tell the formatters apart instead of
+// picking through a single joined message.
+type FormatError struct {
+	LanguageID string
+	Mode       types.FormatMode
+	Failures   []FormatterFailure
+}
+
+// FormatterFailure is one formatter that failed during a run.
+type FormatterFailure struct {
+	// the formatCommand as configured, before any placeholder was filled in
+	Command string
+	Err     error
+}
+
+func (e *FormatError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "could not format for LanguageID: %s", e.LanguageID)
+	if e.Mode == types.FormatModeStrict {
+		b.WriteString(" (strict mode stops at the first failure)")
+	}
+	for _, f := range e.Failures {
+		fmt.Fprintf(&b, "; %s: %v", f.Command, f.Err)
+	}
+	return b.String()
+}
+
+// Unwrap makes every formatter's error reachable through errors.Is and errors.As.
+func (e *FormatError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// formatModeOf returns the format mode that applies to configs. The mode
+// describes how the formatters combine, so it belongs to the list rather than to
+// any one entry; the first entry that sets one speaks for the rest, which lets a
+// config say it once instead of repeating it on every formatter.
+func formatModeOf(configs []resolvedConfig) (types.FormatMode, error) {
+	for _, cfg := range configs {
+		switch cfg.FormatMode {
+		case "":
+			continue
+		case types.FormatModeChain, types.FormatModeFirst, types.FormatModeStrict:
+			return cfg.FormatMode, nil
+		default:
+			return "", fmt.Errorf("unknown formatMode %q, expected one of %q, %q or %q",
+				cfg.FormatMode, types.FormatModeChain, types.FormatModeFirst, types.FormatModeStrict)
+		}
+	}
+
+	return types.FormatModeChain, nil
+}
+
 // this needs to accept textToFormat because in case we have multiple formatters, we can pass previous formatted text.
 // otherwise, we'd format the original file over and over.
-func formatDocument(ctx context.Context, rootPath string, filename string, textToFormat string, rng *types.Range, options types.FormattingOptions, config types.Language) (string, error) {
-	cmdStr := buildFormatCommandString(rootPath, filename, textToFormat, options, rng, config.FormatCommand)
-	cmd := buildExecCmd(ctx, cmdStr, rootPath, config.Env, strings.NewReader(textToFormat))
-	out, err := runFormattingCommand(cmd)
+func formatDocument(ctx context.Context, daemons *daemonPool, rootPath string, filename string, textToFormat string, rng *types.Range, options types.FormattingOptions, config types.Language) (string, error) {
+	if config.FormatDaemon {
+		return formatWithDaemon(ctx, daemons, rootPath, filename, textToFormat, rng, options, config)
+	}
 
-	logs.Log.Logln(logs.Info, cmdStr)
+	var cmd *exec.Cmd
+	if len(config.FormatArgs) > 0 {
+		argv := buildFormatArgv(rootPath, filename, textToFormat, options, rng, config.FormatArgs)
+		logs.Log.Logf(logs.Info, "%q", argv)
+		var err error
+		if cmd, err = buildExecArgv(ctx, argv, rootPath, config, strings.NewReader(textToFormat)); err != nil {
+			return "", fmt.Errorf("formatting error: %w", err)
+		}
+	} else {
+		cmdStr := buildFormatCommandString(rootPath, filename, textToFormat, options, rng, config.FormatCommand)
+		cmd = buildExecCmd(ctx, cmdStr, rootPath, config, strings.NewReader(textToFormat))
+		logs.Log.Logln(logs.Info, cmdStr)
+	}
+
+	out, err := runFormattingCommand(cmd, config.Limits)
 	logs.Log.Logln(logs.Debug, out)
 
 	if err != nil {
@@ -103,32 +279,149 @@ func formatDocument(ctx context.Context, rootPath string, filename string, textT
 	return strings.ReplaceAll(out, carriageReturn, ""), nil
 }
 
-func resolveOptionsPlaceholder(re *regexp.Regexp, match string, options map[string]any, sep string) string {
-	parts := re.FindStringSubmatch(match)
-	flag, opt := parts[1], parts[2]
+// formatChangedLines is formatDocument for a formatter that is only to touch the
+// lines of text that differ from what the document is at its base ref, so that
+// formatting a legacy file does not bury the change at hand in a diff nobody
+// asked for. A formatter that can format a range is run once for every run of
+// changed lines, the last one first, so that what it does to the number of lines
+// leaves the runs before it where they were. Any other formatter formats all of
+// text, and only those of its edits that reach a changed line are kept. When
+// what changed cannot be told, it is an error: formatting all of text instead is
+// the very diff the config asks to be spared, and with format on save nobody
+// gets to look at it before it is applied.
+func formatChangedLines(ctx context.Context, daemons *daemonPool, bases *gitBases, rootPath string, filename string, text string, options types.FormattingOptions, config types.Language) (string, error) {
+	changed, err := gitChangedLines(ctx, bases, rootPath, fileRef{NormalizedFilename: filename, Text: text}, config.FormatBaseRef)
+	if err != nil {
+		return "", fmt.Errorf("formatting error: cannot tell what changed in %s: %w", filename, err)
+	}
+	runs := changed.runs()
+	if len(runs) == 0 {
+		return text, nil
+	}
+
+	if config.FormatCanRange {
+		for _, run := range slices.Backward(runs) {
+			rng := wholeLines(text, run)
+			formatted, err := formatDocument(ctx, daemons, rootPath, filename, text, &rng, options, config)
+			if err != nil {
+				return "", err
+			}
+			text = formatted
+		}
+		return text, nil
+	}
+
+	formatted, err := formatDocument(ctx, daemons, rootPath, filename, text, nil, options, config)
+	if err != nil {
+		return "", err
+	}
+	edits, err := ComputeEdits(text, formatted)
+	if err != nil {
+		return "", err
+	}
+	// an edit that reaches a changed line is kept whole, unchanged lines and all:
+	// half of a reindented block would be worse than either
+	edits = slices.DeleteFunc(edits, func(e types.TextEdit) bool {
+		return !slices.ContainsFunc(runs, func(r lineRun) bool { return editTouchesLines(e, r.first, r.last) })
+	})
+	return ApplyEdits(text, edits)
+}
+
+// wholeLines returns the range that covers the lines of run in text, from the
+// start of the first to the end of the last.
+func wholeLines(text string, run lineRun) types.Range {
+	lines := strings.Split(text, "\n")
+	last := min(run.last, len(lines)-1)
+	first := min(run.first, last)
 
+	return types.Range{
+		Start: types.Position{Line: first, Character: 0},
+		End:   types.Position{Line: last, Character: utf16Len(lines[last])},
+	}
+}
+
+// formatWithDaemon is formatDocument for a formatter kept running as a daemon.
+// The options and the range travel with the request rather than on the command
+// line, since the daemon was started before either was known.
+func formatWithDaemon(ctx context.Context, daemons *daemonPool, rootPath string, filename string, textToFormat string, rng *types.Range, options types.FormattingOptions, config types.Language) (string, error) {
+	key := daemonKeyFor(config.FormatCommand, config.FormatArgs, rootPath)
+	logs.Log.Logf(logs.Info, "%s (daemon)", key)
+
+	resp, err := daemons.request(ctx, key, config,
+		daemonRequest{Filename: filename, Text: textToFormat, Options: options, Range: rng})
+	if err != nil {
+		return "", fmt.Errorf("formatting error: %s", err)
+	}
+
+	logs.Log.Logln(logs.Debug, resp.Stdout)
+
+	if resp.ExitCode != 0 {
+		return "", fmt.Errorf("formatting error: %s: %s", key, resp.Stderr)
+	}
+
+	return strings.ReplaceAll(resp.Stdout, carriageReturn, ""), nil
+}
+
+// formatterName is how a formatter is named in errors: its command as the config
+// spells it.
+func formatterName(config types.Language) string {
+	if len(config.FormatArgs) > 0 {
+		return strings.Join(config.FormatArgs, " ")
+	}
+	return config.FormatCommand
+}
+
+// isFormatterCalled reports whether name picks config's formatter: its command
+// as the config spells it, or the program that command runs, with or without the
+// directory it is in.
+func isFormatterCalled(config types.Language, name string) bool {
+	if name == formatterName(config) {
+		return true
+	}
+
+	program := shellCommandName(config.FormatCommand)
+	if len(config.FormatArgs) > 0 {
+		program = config.FormatArgs[0]
+	}
+	return name == program || name == filepath.Base(program)
+}
+
+// optionParts resolves an options placeholder to what it stands for: nothing, the
+// bare flag, or the flag followed by the option's value. found is false when there
+// is no such option, which leaves the placeholder for a later pass to fill or drop.
+func optionParts(flag, opt string, options map[string]any) (parts []string, found bool) {
 	neg := strings.HasPrefix(opt, "!")
 	key := strings.TrimPrefix(opt, "!")
 
 	v, ok := options[key]
 	if !ok {
-		return match // no option found
+		return nil, false // no option found
 	}
 
 	switch b := v.(type) {
 	case bool:
 		if b == !neg { // bool true and not negated, or bool false and negated
-			return flag
+			return []string{flag}, true
 		}
-		return "" // remove placeholder
+		return nil, true // remove placeholder
 	default:
 		if neg {
-			return "" // negated default makes no sense
+			return nil, true // negated default makes no sense
 		}
-		return fmt.Sprintf("%s%s%v", flag, sep, v)
+		return []string{flag, fmt.Sprint(v)}, true
 	}
 }
 
+func resolveOptionsPlaceholder(re *regexp.Regexp, match string, options map[string]any, sep string) string {
+	parts := re.FindStringSubmatch(match)
+
+	resolved, found := optionParts(parts[1], parts[2], options)
+	if !found {
+		return match
+	}
+	return strings.Join(resolved, sep)
+}
+
 func applyOptionsPlaceholders(command string, options map[string]any) string {
 	// Handle : syntax (flag:value)
 	command = reColon.ReplaceAllStringFunc(command, func(match string) string {
@@ -143,12 +436,12 @@ func applyOptionsPlaceholders(command string, options map[string]any) string {
 	return strings.TrimSpace(command)
 }
 
-func applyRangePlaceholders(command string, rng *types.Range, text string) string {
+func rangeOptions(rng *types.Range, text string) map[string]any {
 	lines := strings.Split(text, "\n")
 	charStart := convertRowColToIndex(lines, rng.Start.Line, rng.Start.Character)
 	charEnd := convertRowColToIndex(lines, rng.End.Line, rng.End.Character)
 
-	rangeOptions := map[string]any{
+	return map[string]any{
 		"charStart": charStart,
 		"charEnd":   charEnd,
 		"rowStart":  rng.Start.Line,
@@ -156,8 +449,10 @@ func applyRangePlaceholders(command string, rng *types.Range, text string) strin
 		"rowEnd":    rng.End.Line,
 		"colEnd":    rng.End.Character,
 	}
+}
 
-	return applyOptionsPlaceholders(command, rangeOptions)
+func applyRangePlaceholders(command string, rng *types.Range, text string) string {
+	return applyOptionsPlaceholders(command, rangeOptions(rng, text))
 }
 
 func buildFormatCommandString(rootPath string, filename string, textToFormat string, options types.FormattingOptions, rng *types.Range, command string) string {
@@ -172,14 +467,67 @@ func buildFormatCommandString(rootPath string, filename string, textToFormat str
 	return reUnfilledPlaceholders.ReplaceAllString(command, "")
 }
 
-func runFormattingCommand(cmd *exec.Cmd) (string, error) {
-	var buf bytes.Buffer
-	cmd.Stderr = &buf
-	b, err := cmd.Output()
+// buildFormatArgv is buildFormatCommandString for a formatter run without a shell.
+// An argument that is nothing but a ${flag:opt} placeholder becomes the flag and
+// the value as two arguments, the way the shell would have split them; anywhere
+// else a placeholder is filled in place. An argument left empty by placeholders
+// nobody gave a value for is dropped rather than passed on as "". The document's
+// placeholders are filled in last, so that a filename that happens to contain
+// ${...} is not taken for a placeholder of its own.
+func buildFormatArgv(rootPath string, filename string, textToFormat string, options types.FormattingOptions, rng *types.Range, args []string) []string {
+	values := make(map[string]any, len(options))
+	if rng != nil {
+		values = rangeOptions(rng, textToFormat)
+	}
+	// the client's options are applied before the range ones in a shell command,
+	// so it is theirs that win a clash here as well
+	maps.Copy(values, options)
+
+	argv := make([]string, 0, len(args))
+	for _, arg := range args {
+		if m := reColon.FindStringSubmatch(arg); m != nil && m[0] == arg {
+			parts, _ := optionParts(m[1], m[2], values)
+			argv = append(argv, parts...)
+			continue
+		}
+
+		expanded := reColon.ReplaceAllStringFunc(arg, func(match string) string {
+			return resolveOptionsPlaceholder(reColon, match, values, " ")
+		})
+		expanded = reEquals.ReplaceAllStringFunc(expanded, func(match string) string {
+			return resolveOptionsPlaceholder(reEquals, match, values, "=")
+		})
+		expanded = dropUnfilledPlaceholders(expanded)
+		if expanded == "" && arg != "" {
+			continue
+		}
+		argv = append(argv, expanded)
+	}
+	return replaceMagicArgs(argv, filename, rootPath)
+}
+
+// dropUnfilledPlaceholders removes from arg every placeholder left without a
+// value, other than those replaceMagicArgs fills in.
+func dropUnfilledPlaceholders(arg string) string {
+	return reUnfilledPlaceholders.ReplaceAllStringFunc(arg, func(placeholder string) string {
+		switch placeholder {
+		case inputPlaceholder, filenamePlaceholder, rootPlaceholder, fileextPlaceholder:
+			return placeholder
+		default:
+			return ""
+		}
+	})
+}
+
+func runFormattingCommand(cmd *exec.Cmd, limits types.Limits) (string, error) {
+	stdout, stderr, err := runLimited(cmd, limits)
+	if errors.Is(err, errOutputLimit) {
+		return "", err
+	}
 	if err != nil {
-		return "", fmt.Errorf("%s: %s", strings.Join(cmd.Args, " "), buf.String())
+		return "", fmt.Errorf("%s: %s", strings.Join(cmd.Args, " "), stderr)
 	}
-	return string(b), nil
+	return string(stdout), nil
 }
 
 func convertRowColToIndex(lines []string, row, col int) int {
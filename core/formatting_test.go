@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -96,12 +97,99 @@ func TestFormatDocumentWithStdin(t *testing.T) {
 	cfg := types.Language{FormatCommand: "cat -"}
 	tmpDir := t.TempDir()
 
-	out, err := formatDocument(t.Context(), tmpDir, "file.txt", "hello text", nil, nil, cfg)
+	out, err := formatDocument(t.Context(), nil, tmpDir, "file.txt", "hello text", nil, nil, cfg)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "hello text", strings.TrimSpace(out))
 }
 
+func TestFormatDocumentWithArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatter below is tr")
+	}
+
+	cfg := types.Language{FormatArgs: []string{"tr", "a-z", "A-Z"}}
+
+	out, err := formatDocument(t.Context(), nil, t.TempDir(), "$(rm -rf ~).txt", "hello text", nil, nil, cfg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "HELLO TEXT", out)
+}
+
+func TestBuildFormatArgv(t *testing.T) {
+	options := types.FormattingOptions{"tabSize": 4, "insertSpaces": true, "name": "two words"}
+	rng := &types.Range{
+		Start: types.Position{Line: 1, Character: 1},
+		End:   types.Position{Line: 1, Character: 3},
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		rng  *types.Range
+		want []string
+	}{
+		{
+			name: "a whole-argument colon placeholder is the flag and the value",
+			args: []string{"fmt", "${--indent:tabSize}"},
+			want: []string{"fmt", "--indent", "4"},
+		},
+		{
+			name: "an equals placeholder stays one argument",
+			args: []string{"fmt", "${--indent=tabSize}"},
+			want: []string{"fmt", "--indent=4"},
+		},
+		{
+			name: "a value is never split",
+			args: []string{"fmt", "${--name:name}"},
+			want: []string{"fmt", "--name", "two words"},
+		},
+		{
+			name: "a true option is the bare flag, a false one nothing",
+			args: []string{"fmt", "${--spaces:insertSpaces}", "${--tabs:!insertSpaces}"},
+			want: []string{"fmt", "--spaces"},
+		},
+		{
+			name: "a placeholder without a value is dropped with its argument",
+			args: []string{"fmt", "${--width:printWidth}", "--stdin-filepath", "${INPUT}"},
+			want: []string{"fmt", "--stdin-filepath", efmlsFile},
+		},
+		{
+			name: "range options are filled when formatting a range",
+			args: []string{"fmt", "${--range-start=charStart}", "${--range-end=charEnd}"},
+			rng:  rng,
+			want: []string{"fmt", "--range-start=7", "--range-end=9"},
+		},
+		{
+			name: "and dropped when formatting the whole document",
+			args: []string{"fmt", "${--range-start=charStart}"},
+			want: []string{"fmt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildFormatArgv(efmlsRoot, efmlsFile, efmlsText, options, tt.rng, tt.args)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuildFormatArgvLeavesTheFilenameAlone(t *testing.T) {
+	file := "/src/${--indent:tabSize}/${weird}.ts"
+	options := types.FormattingOptions{"tabSize": 4}
+
+	got := buildFormatArgv("/src", file, "", options, nil, []string{"fmt", "${--indent=tabSize}", "${INPUT}"})
+	assert.Equal(t, []string{"fmt", "--indent=4", file}, got)
+}
+
+func TestFormatArgsLeftEmptyAreAnError(t *testing.T) {
+	config := types.Language{FormatArgs: []string{"${--x:opt}"}}
+
+	_, err := formatDocument(t.Context(), nil, t.TempDir(), "a.txt", "text", nil, types.FormattingOptions{}, config)
+	assert.ErrorIs(t, err, errNoCommand)
+}
+
 func TestRunFormattersSuccess(t *testing.T) {
 	tmpDir := t.TempDir()
 	testfile := filepath.Join(tmpDir, "text.txt")
@@ -152,6 +240,37 @@ func TestRunFormattersUsesPreviousText(t *testing.T) {
 	assert.Equal(t, "helloconfig1config2\n", edits[0].NewText)
 }
 
+func TestRunFormatterRunsOnlyTheOneNamed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatters below are POSIX tools")
+	}
+
+	uri := ParseLocalFileToURI(filepath.Join(t.TempDir(), "text.txt"))
+	h := NewHandler(map[string][]types.Language{
+		"go": {
+			{FormatCommand: `echo "$(cat -)appended"`},
+			{FormatArgs: []string{"/usr/bin/env", "tr", "a-z", "A-Z"}},
+		},
+	})
+	t.Cleanup(h.Close)
+	require.NoError(t, h.OpenFile(uri, "go", 1, "hello\n"))
+
+	for _, name := range []string{"/usr/bin/env tr a-z A-Z", "/usr/bin/env", "env"} {
+		edits, err := h.RunFormatter(t.Context(), &recordingReporter{}, uri, nil, nil, name)
+		require.NoError(t, err, name)
+		require.Len(t, edits, 1, name)
+		assert.Equal(t, "HELLO\n", edits[0].NewText, name)
+	}
+
+	edits, err := h.RunFormatter(t.Context(), &recordingReporter{}, uri, nil, nil, "echo")
+	require.NoError(t, err)
+	require.Len(t, edits, 1)
+	assert.Equal(t, "helloappended\n", edits[0].NewText, "a shell command goes by the program it starts")
+
+	_, err = h.RunFormatter(t.Context(), &recordingReporter{}, uri, nil, nil, "prettier")
+	assert.ErrorContains(t, err, `no formatter called "prettier"`)
+}
+
 func TestRunFormattersRequireRootMatcher(t *testing.T) {
 	base, _ := os.Getwd()
 	filePath := filepath.Join(base, "foo")
@@ -211,3 +330,233 @@ func TestRunFormattersEndsProgressWhenEveryFormatterFails(t *testing.T) {
 func (h *LangHandler) runAllFormatters(t *testing.T, uri types.DocumentURI) ([]types.TextEdit, error) {
 	return h.RunAllFormatters(t.Context(), &recordingReporter{}, uri, nil, types.FormattingOptions{})
 }
+
+func TestRunFormattersModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatters below are written as POSIX shell commands")
+	}
+
+	const (
+		fail   = "echo broken >&2; exit 1"
+		first  = `echo "$(cat -)first"`
+		second = `echo "$(cat -)second"`
+	)
+
+	tests := []struct {
+		name       string
+		mode       types.FormatMode
+		formatters []string
+		want       string
+		// how many formatters the error should list, when the run fails
+		wantFailures int
+	}{
+		{"chain is the default and runs everything", "", []string{first, second}, "hellofirstsecond\n", 0},
+		{"chain skips a failing formatter", types.FormatModeChain, []string{first, fail, second}, "hellofirstsecond\n", 0},
+		{"chain fails only when nothing formatted", types.FormatModeChain, []string{fail, fail}, "", 2},
+		{"first stops at the first success", types.FormatModeFirst, []string{first, second}, "hellofirst\n", 0},
+		{"first falls back past a failure", types.FormatModeFirst, []string{fail, second}, "hellosecond\n", 0},
+		{"first fails when every fallback does", types.FormatModeFirst, []string{fail, fail}, "", 2},
+		{"strict runs everything when nothing fails", types.FormatModeStrict, []string{first, second}, "hellofirstsecond\n", 0},
+		{"strict aborts the chain on a failure", types.FormatModeStrict, []string{first, fail, second}, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testfile := filepath.Join(t.TempDir(), "text.txt")
+			uri := ParseLocalFileToURI(testfile)
+
+			configs := make([]types.Language, 0, len(tt.formatters))
+			for _, command := range tt.formatters {
+				configs = append(configs, types.Language{FormatCommand: command})
+			}
+			// the first entry speaks for the whole list
+			configs[0].FormatMode = tt.mode
+
+			h := &LangHandler{
+				files: map[types.DocumentURI]*fileRef{
+					uri: {Text: "hello", LanguageID: "go", NormalizedFilename: testfile},
+				},
+				configs: map[string][]types.Language{"go": configs},
+			}
+
+			edits, err := h.runAllFormatters(t, uri)
+
+			if tt.wantFailures > 0 {
+				var formatErr *FormatError
+				require.ErrorAs(t, err, &formatErr)
+				assert.Len(t, formatErr.Failures, tt.wantFailures)
+				assert.Equal(t, fail, formatErr.Failures[0].Command)
+				assert.Nil(t, edits, "a failed run must not hand out a partial result")
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, edits, 1)
+			assert.Equal(t, tt.want, edits[0].NewText)
+		})
+	}
+}
+
+func TestRunFormattersRejectsUnknownMode(t *testing.T) {
+	testfile := filepath.Join(t.TempDir(), "text.txt")
+	uri := ParseLocalFileToURI(testfile)
+
+	h := &LangHandler{
+		files: map[types.DocumentURI]*fileRef{
+			uri: {Text: "hello", LanguageID: "go", NormalizedFilename: testfile},
+		},
+		configs: map[string][]types.Language{
+			"go": {{FormatCommand: "cat", FormatMode: "fastest"}},
+		},
+	}
+
+	_, err := h.runAllFormatters(t, uri)
+	assert.ErrorContains(t, err, "fastest")
+}
+
+func TestFormatErrorUnwrapsEveryFailure(t *testing.T) {
+	first := errors.New("first")
+	second := errors.New("second")
+
+	err := error(&FormatError{
+		LanguageID: "go",
+		Failures:   []FormatterFailure{{Command: "a", Err: first}, {Command: "b", Err: second}},
+	})
+
+	assert.ErrorIs(t, err, first)
+	assert.ErrorIs(t, err, second)
+	assert.Equal(t, "could not format for LanguageID: go; a: first; b: second", err.Error())
+}
+
+func TestRunOnTypeFormattersKeepsEditsNearTheCursor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatter below is written as a POSIX shell command")
+	}
+
+	testfile := filepath.Join(t.TempDir(), "text.txt")
+	uri := ParseLocalFileToURI(testfile)
+
+	h := &LangHandler{
+		files: map[types.DocumentURI]*fileRef{
+			uri: {Text: "a\nb\nc\nd\ne\n", LanguageID: "go", NormalizedFilename: testfile},
+		},
+		configs: map[string][]types.Language{
+			"go": {
+				// changes the first and the last line, which are two separate edits
+				{FormatCommand: "sed 's/^a$/A/; s/^e$/E/'", FormatOnTypeTriggers: []string{"}"}},
+				// would change every line, but does not ask for this trigger
+				{FormatCommand: "tr a-z X", FormatOnTypeTriggers: []string{";"}},
+			},
+		},
+	}
+
+	edits, err := h.RunOnTypeFormatters(t.Context(), &recordingReporter{}, uri,
+		types.Position{Line: 1, Character: 1}, "}", types.FormattingOptions{})
+	require.NoError(t, err)
+
+	require.Len(t, edits, 1, "the edit far from the cursor must be dropped")
+	assert.Equal(t, "A\n", edits[0].NewText)
+	assert.Equal(t, 0, edits[0].Range.Start.Line)
+}
+
+func TestRunOnTypeFormattersIgnoresOtherTriggers(t *testing.T) {
+	testfile := filepath.Join(t.TempDir(), "text.txt")
+	uri := ParseLocalFileToURI(testfile)
+
+	h := &LangHandler{
+		files: map[types.DocumentURI]*fileRef{
+			uri: {Text: "hello\n", LanguageID: "go", NormalizedFilename: testfile},
+		},
+		configs: map[string][]types.Language{
+			"go": {{FormatCommand: "exit 1", FormatOnTypeTriggers: []string{"}"}}},
+		},
+	}
+
+	edits, err := h.RunOnTypeFormatters(t.Context(), &recordingReporter{}, uri,
+		types.Position{Line: 0, Character: 1}, "\n", types.FormattingOptions{})
+
+	assert.NoError(t, err, "a formatter that did not ask for this character must not run")
+	assert.Empty(t, edits)
+}
+
+func TestEditTouchesLines(t *testing.T) {
+	edit := func(startLine, endLine, endChar int) types.TextEdit {
+		return types.TextEdit{Range: types.Range{
+			Start: types.Position{Line: startLine},
+			End:   types.Position{Line: endLine, Character: endChar},
+		}}
+	}
+
+	tests := []struct {
+		name string
+		edit types.TextEdit
+		want bool
+	}{
+		{"replaces a line inside", edit(3, 4, 0), true},
+		{"replaces the line before", edit(1, 2, 0), false},
+		{"replaces the line after", edit(5, 6, 0), false},
+		{"spans the whole window", edit(0, 9, 0), true},
+		{"inserts at the first line", edit(3, 3, 0), true},
+		{"inserts right after the window", edit(5, 5, 0), false},
+		{"ends mid-line on the first line", edit(1, 3, 2), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, editTouchesLines(tt.edit, 3, 4))
+		})
+	}
+}
+
+func TestFormatChangedLinesOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatters below are written as POSIX shell commands")
+	}
+
+	dir := newGitRepo(t, map[string]string{"a.txt": "a\nb\nc\nd\ne\n"})
+	testfile := filepath.Join(dir, "a.txt")
+	uri := ParseLocalFileToURI(testfile)
+	run := func(t *testing.T, text string, config types.Language) ([]types.TextEdit, error) {
+		t.Helper()
+
+		config.FormatChangedLinesOnly = true
+		h := &LangHandler{
+			files: map[types.DocumentURI]*fileRef{
+				uri: {Text: text, LanguageID: "txt", NormalizedFilename: filepath.ToSlash(testfile)},
+			},
+			configs: map[string][]types.Language{"txt": {config}},
+		}
+		return h.runAllFormatters(t, uri)
+	}
+	format := func(t *testing.T, text string, config types.Language) string {
+		t.Helper()
+
+		edits, err := run(t, text, config)
+		require.NoError(t, err)
+		formatted, err := ApplyEdits(text, edits)
+		require.NoError(t, err)
+		return formatted
+	}
+
+	t.Run("the edits elsewhere are dropped", func(t *testing.T) {
+		config := types.Language{FormatCommand: "sed 's/^a$/A/; s/^x$/X/; s/^e$/E/'", FormatBaseRef: "HEAD"}
+		assert.Equal(t, "a\nb\nX\nd\ne\n", format(t, "a\nb\nx\nd\ne\n", config))
+	})
+	t.Run("a formatter that can format a range is asked for each run of changed lines", func(t *testing.T) {
+		config := types.Language{
+			// brackets the lines of the range, and adds one after it so that a run
+			// formatted first moving the ones after it would show
+			FormatCommand:  `awk ${-vs=rowStart} ${-ve=rowEnd} 'NR-1>=s && NR-1<=e {print "[" $0 "]"; if (NR-1==e) print "+"; next} 1'`,
+			FormatCanRange: true,
+		}
+		assert.Equal(t, "[x]\n+\nb\nc\n[y]\n[z]\n+\ne\n", format(t, "x\nb\nc\ny\nz\ne\n", config))
+	})
+	t.Run("nothing changed", func(t *testing.T) {
+		assert.Equal(t, "a\nb\nc\nd\ne\n", format(t, "a\nb\nc\nd\ne\n", types.Language{FormatCommand: "tr a-z A-Z"}))
+	})
+	t.Run("a base that cannot be had formats nothing", func(t *testing.T) {
+		edits, err := run(t, "a\nb\nx\nd\ne\n", types.Language{FormatCommand: "tr a-z A-Z", FormatBaseRef: "no-such-branch"})
+		assert.ErrorContains(t, err, "cannot tell what changed")
+		assert.Empty(t, edits)
+	})
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob reports whether name, a slash-separated path relative to some
+// directory, matches pattern. A ** element matches any number of path elements,
+// none included, and every other element is matched against one element of name
+// as by path.Match.
+//
+// A pattern without a slash is matched against the last element of name alone,
+// so a bare file name matches that file in any directory, the way it does in a
+// .gitignore. A malformed pattern matches nothing.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	return matchElements(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// relativeTo returns fname relative to dir, with slashes, and whether fname is in
+// dir at all. A dir of "" holds nothing.
+func relativeTo(dir, fname string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(dir, fname)
+	if err != nil || !filepath.IsLocal(rel) || rel == "." {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{".golangci.yml", ".golangci.yml", true},
+		{".golangci.yml", "sub/dir/.golangci.yml", true},
+		{".golangci.yml", "golangci.yml", false},
+		{".eslintrc*", ".eslintrc.json", true},
+		{".eslintrc*", "web/.eslintrc.cjs", true},
+		{"config/lint.toml", "config/lint.toml", true},
+		{"config/lint.toml", "sub/config/lint.toml", false},
+		{"/config/lint.toml", "config/lint.toml", true},
+		{"**/lint.toml", "lint.toml", true},
+		{"**/lint.toml", "a/b/lint.toml", true},
+		{"config/**", "config/a/b.toml", true},
+		{"config/**", "other/a.toml", false},
+		{"a/**/b/*.yml", "a/x/y/b/c.yml", true},
+		{"a/**/b/*.yml", "a/b/c.yml", true},
+		{"a/**/b/*.yml", "a/b/c/d.yml", false},
+		{"*/lint.toml", "a/b/lint.toml", false},
+		{"[", "[", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchGlob(tt.pattern, tt.name))
+		})
+	}
+}
+
+func TestRelativeTo(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "root")
+
+	rel, ok := relativeTo(dir, filepath.Join(dir, "a", "b.txt"))
+	assert.True(t, ok)
+	assert.Equal(t, "a/b.txt", rel)
+
+	_, ok = relativeTo(dir, filepath.Join(filepath.Dir(dir), "b.txt"))
+	assert.False(t, ok, "a sibling of the directory is not in it")
+	_, ok = relativeTo(dir, dir+"2/b.txt")
+	assert.False(t, ok, "nor is a file in a directory that merely shares its prefix")
+	_, ok = relativeTo(dir, dir)
+	assert.False(t, ok, "nor is the directory itself")
+	_, ok = relativeTo("", filepath.Join(dir, "b.txt"))
+	assert.False(t, ok, "and no directory holds nothing")
+}
@@ -23,6 +23,15 @@ type LangHandler struct {
 	configs  map[string][]types.Language
 	files    map[types.DocumentURI]*fileRef
 	rootPath string
+	filter   diagnosticFilter
+
+	// daemons is safe for concurrent use on its own and is never replaced, so
+	// runs use it without mu
+	daemons *daemonPool
+	// diagnostics guards itself the same way
+	diagnostics diagnosticStore
+	// and so does bases
+	bases gitBases
 }
 
 type fileRef struct {
@@ -40,6 +49,7 @@ type documentSnapshot struct {
 	file     fileRef
 	configs  map[string][]types.Language
 	rootPath string
+	filter   diagnosticFilter
 }
 
 // ErrDocumentChanged reports that a document was edited while it was being
@@ -81,7 +91,7 @@ func (h *LangHandler) snapshot(uri types.DocumentURI) (documentSnapshot, error)
 		return documentSnapshot{}, fmt.Errorf("document not found: %v", uri)
 	}
 
-	return documentSnapshot{file: *f, configs: h.configs, rootPath: h.rootPath}, nil
+	return documentSnapshot{file: *f, configs: h.configs, rootPath: h.rootPath, filter: h.filter}, nil
 }
 
 // NewHandler returns a handler for the given language configuration. Passing nil
@@ -95,9 +105,16 @@ func NewHandler(configs map[string][]types.Language) *LangHandler {
 	return &LangHandler{
 		configs: configs,
 		files:   make(map[types.DocumentURI]*fileRef),
+		daemons: newDaemonPool(),
 	}
 }
 
+// Close stops the tool daemons the handler keeps running. Runs still using one
+// fail, and no new ones are started.
+func (h *LangHandler) Close() {
+	h.daemons.close()
+}
+
 func (h *LangHandler) Initialize(params types.InitializeParams) (types.InitializeResult, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -112,20 +129,20 @@ func (h *LangHandler) Initialize(params types.InitializeParams) (types.Initializ
 
 	var hasFormatCommand bool
 	var hasRangeFormatCommand bool
+	var onTypeTriggers []string
 
 	if params.InitializationOptions != nil {
 		hasFormatCommand = params.InitializationOptions.DocumentFormatting
 		hasRangeFormatCommand = params.InitializationOptions.RangeFormatting
+		onTypeTriggers = append(onTypeTriggers, params.InitializationOptions.OnTypeFormattingTriggers...)
 	}
 
 	for _, config := range h.configs {
 		for _, lang := range config {
-			if lang.FormatCommand != "" {
+			if lang.HasFormatter() {
 				hasFormatCommand = true
-				if lang.FormatCanRange {
-					hasRangeFormatCommand = true
-					break
-				}
+				hasRangeFormatCommand = hasRangeFormatCommand || lang.FormatCanRange
+				onTypeTriggers = append(onTypeTriggers, lang.FormatOnTypeTriggers...)
 			}
 		}
 	}
@@ -139,25 +156,54 @@ func (h *LangHandler) Initialize(params types.InitializeParams) (types.Initializ
 			},
 			DocumentFormattingProvider: hasFormatCommand,
 			RangeFormattingProvider:    hasRangeFormatCommand,
+			OnTypeFormattingProvider:   onTypeFormattingOptions(onTypeTriggers),
 		},
 	}, nil
 }
 
+// onTypeFormattingOptions announces triggers, or nothing at all when there are
+// none: the protocol has no way to say "on-type formatting, but for no character".
+// Several languages routinely share a trigger, and the client only needs to hear
+// about each one once.
+func onTypeFormattingOptions(triggers []string) *types.DocumentOnTypeFormattingOptions {
+	var unique []string
+	for _, t := range triggers {
+		if t != "" && !slices.Contains(unique, t) {
+			unique = append(unique, t)
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil
+	}
+
+	return &types.DocumentOnTypeFormattingOptions{
+		FirstTriggerCharacter: unique[0],
+		MoreTriggerCharacter:  unique[1:],
+	}
+}
+
 func (h *LangHandler) UpdateConfiguration(config *types.Config) {
-	if config.Languages == nil {
-		return
+	if config.DaemonIdleTimeout > 0 {
+		h.daemons.setIdleTimeout(config.DaemonIdleTimeout)
 	}
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.configs = config.Languages
+
+	h.filter.update(config)
+	if config.Languages != nil {
+		h.configs = config.Languages
+	}
 }
 
 func (h *LangHandler) CloseFile(uri types.DocumentURI) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	delete(h.files, uri)
+	h.mu.Unlock()
+
+	// not under mu: a publish holds the store while it looks up open documents
+	h.diagnostics.forget(uri)
 }
 
 func (h *LangHandler) OpenFile(uri types.DocumentURI, languageID string, version int, text string) error {
@@ -181,6 +227,49 @@ func (h *LangHandler) OpenFile(uri types.DocumentURI, languageID string, version
 	return nil
 }
 
+// openFile returns the document at uri if it is open.
+func (h *LangHandler) openFile(uri types.DocumentURI) (fileRef, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if f, ok := h.files[uri]; ok {
+		return *f, true
+	}
+	// a linter names files as the file system has them, which need not be the
+	// way the client spelled them
+	for other, f := range h.files {
+		if comparePaths(string(other), string(uri)) {
+			return *f, true
+		}
+	}
+
+	return fileRef{}, false
+}
+
+// OpenDocuments lists the documents that are open, in no particular order, each
+// with the version it is at.
+func (h *LangHandler) OpenDocuments() []types.VersionedTextDocumentIdentifier {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	documents := make([]types.VersionedTextDocumentIdentifier, 0, len(h.files))
+	for uri, f := range h.files {
+		documents = append(documents, types.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: types.TextDocumentIdentifier{URI: uri},
+			Version:                f.Version,
+		})
+	}
+
+	return documents
+}
+
+// RestartTools stops the tool daemons, so that the next run starts them afresh:
+// after a tool was upgraded, say, or its own configuration changed in a way it
+// only reads at startup.
+func (h *LangHandler) RestartTools() {
+	h.daemons.stopWhere(func(daemonKey) bool { return true })
+}
+
 func (h *LangHandler) UpdateFile(uri types.DocumentURI, text string, version *int) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -209,12 +298,21 @@ type resolvedConfig struct {
 // its working directory. keep decides what "applies" means for the caller, which
 // is the only thing linting and formatting disagree about here.
 //
+// A config's linter is taken out of it for a document that lintExclude, its own
+// or the top level one, excludes, before keep sees it: no run ever starts it
+// there, while the config's formatter still applies.
+//
 // Resolving the directory during selection rather than afterwards is what keeps
 // the marker search to one walk per config: the same walk answers both whether a
 // config requiring a marker may run at all and where its tool should run.
 func (s documentSnapshot) resolveConfigs(keep func(types.Language) bool) []resolvedConfig {
+	excluded := s.lintExcludedBy(s.filter.lintExclude) != ""
+
 	var configs []resolvedConfig
 	for _, cfg := range slices.Concat(s.configs[s.file.LanguageID], s.configs[types.Wildcard]) {
+		if cfg.HasLinter() && (excluded || s.lintExcludedBy(cfg.LintExclude) != "") {
+			cfg.LintCommand, cfg.LintArgs = "", nil
+		}
 		if !keep(cfg) {
 			continue
 		}
@@ -233,6 +331,12 @@ func (s documentSnapshot) resolveConfigs(keep func(types.Language) bool) []resol
 	return configs
 }
 
+// lintExcludedBy returns the first of patterns that excludes the snapshot's
+// document, or "" if none does.
+func (s documentSnapshot) lintExcludedBy(patterns []string) string {
+	return excludedBy(s.rootPath, s.file.NormalizedFilename, patterns)
+}
+
 // matchRootPath returns the closest ancestor directory of fname that holds one of
 // the markers, or "" if there is none. A marker ending in "/" has to be a
 // directory, anything else has to not be one.
@@ -361,3 +465,22 @@ scan:
 
 	return out.String()
 }
+
+// replaceMagicArgs is replaceMagicStrings for a tool configured as a list of
+// arguments. No shell is involved, so there is nothing to quote or escape: each
+// argument is handed to the tool as it is, placeholders and all, and a hostile
+// filename is just a string.
+func replaceMagicArgs(args []string, fname, rootPath string) []string {
+	replacer := strings.NewReplacer(
+		inputPlaceholder, fname,
+		filenamePlaceholder, filepath.FromSlash(fname),
+		rootPlaceholder, rootPath,
+		fileextPlaceholder, strings.TrimPrefix(filepath.Ext(fname), "."),
+	)
+
+	out := make([]string, 0, len(args))
+	for _, arg := range args {
+		out = append(out, replacer.Replace(arg))
+	}
+	return out
+}
@@ -348,3 +348,49 @@ func TestConcurrentDocumentSyncWhileLinting(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestInitializeAnnouncesOnTypeTriggers(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs map[string][]types.Language
+		options *types.InitializeOptions
+		want    *types.DocumentOnTypeFormattingOptions
+	}{
+		{
+			name:    "nothing asked for on-type formatting",
+			configs: map[string][]types.Language{"go": {{FormatCommand: "gofmt"}}},
+			want:    nil,
+		},
+		{
+			name: "triggers shared between languages are announced once",
+			configs: map[string][]types.Language{
+				"go": {{FormatCommand: "gofmt", FormatOnTypeTriggers: []string{"}"}}},
+				"sh": {{FormatCommand: "shfmt", FormatOnTypeTriggers: []string{"}"}}},
+			},
+			want: &types.DocumentOnTypeFormattingOptions{FirstTriggerCharacter: "}", MoreTriggerCharacter: []string{}},
+		},
+		{
+			name: "a linter cannot ask for formatting",
+			configs: map[string][]types.Language{
+				"go": {{LintCommand: "vet", FormatOnTypeTriggers: []string{"}"}}},
+			},
+			want: nil,
+		},
+		{
+			name:    "configuration that arrives later can be announced up front",
+			options: &types.InitializeOptions{OnTypeFormattingTriggers: []string{"\n", ";"}},
+			want:    &types.DocumentOnTypeFormattingOptions{FirstTriggerCharacter: "\n", MoreTriggerCharacter: []string{";"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(tt.configs)
+
+			result, err := h.Initialize(types.InitializeParams{InitializationOptions: tt.options})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, result.Capabilities.OnTypeFormattingProvider)
+		})
+	}
+}
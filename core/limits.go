@@ -0,0 +1,292 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// errOutputLimit is what a tool that printed more than its maxOutputBytes fails
+// with.
+var errOutputLimit = errors.New("output limit exceeded")
+
+// inheritedEnv is the part of flint-ls' own environment a tool gets to see.
+func inheritedEnv(allowlist []string) []string {
+	if allowlist == nil {
+		return os.Environ()
+	}
+
+	// never nil: to exec.Cmd a nil environment means the whole of ours
+	env := make([]string, 0, len(allowlist))
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, pattern := range allowlist {
+			if envNameMatches(pattern, name) {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	return env
+}
+
+func envNameMatches(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return pattern == name
+}
+
+// ioprioClasses are the I/O scheduling classes ioClass may name, by their number
+// in ioprio_set(2).
+var ioprioClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// validateLimits rejects limits that could never be applied, before any tool is
+// started with them.
+func validateLimits(limits types.Limits) error {
+	if limits.IOClass != "" {
+		if _, ok := ioprioClasses[limits.IOClass]; !ok {
+			return fmt.Errorf("unknown ioClass %q", limits.IOClass)
+		}
+	}
+	if limits.IOPriority < 0 || limits.IOPriority > 7 {
+		return fmt.Errorf("ioPriority %d is not between 0 and 7", limits.IOPriority)
+	}
+	return nil
+}
+
+// startCmd starts cmd confined to limits. A tool whose limits cannot be applied
+// is not run at all, rather than left to run without the bounds the config asked
+// for.
+func startCmd(cmd *exec.Cmd, limits types.Limits) error {
+	if err := validateLimits(limits); err != nil {
+		return err
+	}
+	return startConfined(cmd, limits)
+}
+
+// runLimited runs cmd to completion under limits and returns what it printed.
+func runLimited(cmd *exec.Cmd, limits types.Limits) (stdout, stderr []byte, err error) {
+	budget := newOutputBudget(cmd, limits)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &cappedWriter{budget: budget, w: &outBuf}
+	cmd.Stderr = &cappedWriter{budget: budget, w: &errBuf}
+
+	if err := startCmd(cmd, limits); err != nil {
+		return nil, nil, err
+	}
+	err = cmd.Wait()
+
+	if budget.overflowed() {
+		err = outputLimitError(cmd, limits)
+	}
+	return outBuf.Bytes(), errBuf.Bytes(), err
+}
+
+// maxErrorOutput is how much of a failing tool's stderr makes it into the error
+// reported for it. The start of it is what explains the failure, and the error
+// ends up in an editor notification, not a log.
+const maxErrorOutput = 4096
+
+// streamLimited runs cmd to completion under limits and hands what it prints on
+// stream to consume while it is being printed. Nothing is held on to here, so a
+// tool printing without end costs time rather than memory. What consume leaves
+// unread is drained, since a tool blocked writing to a full pipe would never
+// exit.
+//
+// The start of whatever the tool prints on stderr is returned too, whichever
+// stream is consumed, to explain a failure with.
+func streamLimited(cmd *exec.Cmd, limits types.Limits, stream types.OutputStream, consume func(io.Reader)) (stderr []byte, err error) {
+	budget := newOutputBudget(cmd, limits)
+
+	pr, pw := io.Pipe()
+	// both streams may end up in the same reader, and a line is only ever handed
+	// to it whole
+	var mu sync.Mutex
+	stdoutLines := &lineWriter{mu: &mu, w: pw}
+	stderrLines := &lineWriter{mu: &mu, w: pw}
+	errHead := &headBuffer{max: maxErrorOutput}
+
+	var toStdout, toStderr io.Writer
+	switch stream {
+	case types.OutputStreamStdout:
+		toStdout, toStderr = stdoutLines, errHead
+	case types.OutputStreamStderr:
+		toStdout, toStderr = io.Discard, io.MultiWriter(stderrLines, errHead)
+	default:
+		toStdout, toStderr = stdoutLines, io.MultiWriter(stderrLines, errHead)
+	}
+	cmd.Stdout = &cappedWriter{budget: budget, w: toStdout}
+	cmd.Stderr = &cappedWriter{budget: budget, w: toStderr}
+
+	if err := startCmd(cmd, limits); err != nil {
+		return nil, err
+	}
+
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		consume(pr)
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+
+	err = cmd.Wait()
+	// a last line without a newline is still a line
+	_ = stdoutLines.flush()
+	_ = stderrLines.flush()
+	_ = pw.Close()
+	<-consumed
+
+	if budget.overflowed() {
+		err = outputLimitError(cmd, limits)
+	}
+	return errHead.buf.Bytes(), err
+}
+
+func outputLimitError(cmd *exec.Cmd, limits types.Limits) error {
+	return fmt.Errorf("%s: %w: printed more than %d bytes and was killed", cmd.Path, errOutputLimit, limits.MaxOutputBytes)
+}
+
+// outputBudget is how much a tool may print, across all of its streams. Past that
+// the tool is killed: output that large is a tool gone wrong rather than one with
+// that much to say, and taking all of it is how a runaway tool takes the editor
+// down with it.
+type outputBudget struct {
+	mu       sync.Mutex
+	written  int64
+	max      int64
+	kill     func()
+	exceeded bool
+}
+
+func newOutputBudget(cmd *exec.Cmd, limits types.Limits) *outputBudget {
+	return &outputBudget{max: limits.MaxOutputBytes, kill: func() { killCmd(cmd) }}
+}
+
+// take returns how many of n more bytes fit in the budget, and kills the tool
+// the first time they do not all fit.
+func (b *outputBudget) take(n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exceeded {
+		return 0
+	}
+	if b.max > 0 && b.written+int64(n) > b.max {
+		n = int(b.max - b.written)
+		b.exceeded = true
+		b.kill()
+	}
+	b.written += int64(n)
+
+	return n
+}
+
+func (b *outputBudget) overflowed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
+
+// cappedWriter passes on what a tool prints on one stream for as long as the
+// budget allows. Anything past it is swallowed but reported as written, so that
+// the copy feeding this keeps draining the pipe until the kill lands instead of
+// giving up on a short write and leaving the tool blocked on a full one.
+type cappedWriter struct {
+	budget *outputBudget
+	w      io.Writer
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if n := c.budget.take(len(p)); n > 0 {
+		if _, err := c.w.Write(p[:n]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// maxPartialLine is how much of a line lineWriter holds back waiting for its end.
+// A line longer than this is beyond what the errorformat scanner takes anyway,
+// so it is passed on in pieces rather than held on to.
+const maxPartialLine = 64 * 1024
+
+// lineWriter passes on whole lines only, so that two streams merged into one
+// reader never interleave in the middle of a line. mu is shared by the writers
+// being merged. Each stream is written from a single goroutine, so the partial
+// line needs no lock of its own.
+type lineWriter struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	partial []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+
+	end := bytes.LastIndexByte(l.partial, '\n') + 1
+	if end == 0 {
+		if len(l.partial) < maxPartialLine {
+			return len(p), nil
+		}
+		end = len(l.partial)
+	}
+
+	if err := l.pass(end); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush passes on what is left of a last line that never got its newline.
+func (l *lineWriter) flush() error {
+	return l.pass(len(l.partial))
+}
+
+func (l *lineWriter) pass(end int) error {
+	if end == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.w.Write(l.partial[:end])
+	l.partial = append(l.partial[:0], l.partial[end:]...)
+	return err
+}
+
+// headBuffer keeps the first max bytes written to it and drops the rest.
+type headBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// killCmd kills a started command the way cancelling its context would, which
+// for a killable command means its whole process group.
+func killCmd(cmd *exec.Cmd) {
+	if cmd.Cancel != nil {
+		_ = cmd.Cancel()
+		return
+	}
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// see ioprio_set(2)
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// limitsShimArg marks a run of flint-ls' own binary as the shim that confines
+// itself to a tool's limits and then becomes the tool, see ExecLimited.
+const limitsShimArg = "__flint-ls-limits"
+
+// startConfined starts cmd through the limits shim, so that the limits hold from
+// the tool's first instruction on and everything it starts inherits them. Go
+// offers no hook between fork and exec to set them in, so flint-ls' own binary
+// is exec'd in between instead. The shim reports what went wrong on a pipe that
+// closes when it execs the tool, which is how a limit the kernel refuses still
+// fails the start rather than the tool.
+func startConfined(cmd *exec.Cmd, limits types.Limits) error {
+	if limits.MemoryBytes == 0 && limits.CPUSeconds == 0 && limits.Nice == 0 && limits.IOClass == "" {
+		return cmd.Start()
+	}
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+	report, reportWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+
+	path := cmd.Path
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, reportWriter)
+	cmd.Args = append([]string{self, limitsShimArg, strconv.Itoa(fd), string(encoded), path}, cmd.Args...)
+	cmd.Path = self
+
+	err = cmd.Start()
+	reportWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	// nothing but the end of the pipe means the tool is running
+	failure, err := io.ReadAll(report)
+	if err == nil && len(failure) == 0 {
+		return nil
+	}
+	if err == nil {
+		err = errors.New(string(failure))
+	}
+	killCmd(cmd)
+	_ = cmd.Wait()
+	return fmt.Errorf("applying limits to %s: %w", path, err)
+}
+
+// ExecLimited is the other half of a start with limits: in a process started as
+// the limits shim it applies the limits to itself and execs the tool, and does
+// not return. In any other process it returns at once. Every binary that starts
+// tools with limits, flint-ls' own and the tests', calls it before anything else.
+func ExecLimited() {
+	if len(os.Args) < 6 || os.Args[1] != limitsShimArg {
+		return
+	}
+	fd, err := strconv.Atoi(os.Args[2])
+	if err != nil {
+		os.Exit(2)
+	}
+	// the tool inherits none of this
+	syscall.CloseOnExec(fd)
+	report := os.NewFile(uintptr(fd), "limits report")
+	fail := func(err error) {
+		fmt.Fprint(report, err)
+		os.Exit(1)
+	}
+
+	var limits types.Limits
+	if err := json.Unmarshal([]byte(os.Args[3]), &limits); err != nil {
+		fail(err)
+	}
+	path, argv := os.Args[4], os.Args[5:]
+
+	// niceness and I/O priority belong to a thread, and the one that execs is the
+	// one the tool starts out as
+	runtime.LockOSThread()
+	if err := applyLimits(limits); err != nil {
+		fail(err)
+	}
+	fail(fmt.Errorf("exec %s: %w", path, syscall.Exec(path, argv, os.Environ())))
+}
+
+// applyLimits confines the calling thread, and the process it becomes, to
+// limits.
+func applyLimits(limits types.Limits) error {
+	if limits.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, limits.Nice); err != nil {
+			return fmt.Errorf("nice %d: %w", limits.Nice, err)
+		}
+	}
+
+	if limits.IOClass != "" {
+		prio := ioprioClasses[limits.IOClass]<<ioprioClassShift | limits.IOPriority
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(prio)); errno != 0 {
+			return fmt.Errorf("ioClass %s: %w", limits.IOClass, errno)
+		}
+	}
+
+	// the hard limits too, so the tool cannot simply raise its soft ones back up.
+	// Last, since the shim itself has to live within them as well
+	if limits.CPUSeconds != 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: limits.CPUSeconds, Max: limits.CPUSeconds}); err != nil {
+			return fmt.Errorf("cpu limit: %w", err)
+		}
+	}
+
+	if limits.MemoryBytes != 0 {
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &syscall.Rlimit{Cur: limits.MemoryBytes, Max: limits.MemoryBytes}); err != nil {
+			return fmt.Errorf("memory limit: %w", err)
+		}
+	}
+
+	return nil
+}
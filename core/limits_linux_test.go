@@ -0,0 +1,82 @@
+package core
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestLimitsAreAppliedToTheTool(t *testing.T) {
+	cmd, err := buildExecArgv(t.Context(), []string{"sleep", "30"}, t.TempDir(), types.Language{}, nil)
+	require.NoError(t, err)
+
+	limits := types.Limits{MemoryBytes: 1 << 30, CPUSeconds: 7, Nice: 5, IOClass: "idle"}
+	require.NoError(t, startCmd(cmd, limits))
+	t.Cleanup(func() {
+		killCmd(cmd)
+		_ = cmd.Wait()
+	})
+
+	pid := cmd.Process.Pid
+	procLimits, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/limits")
+	require.NoError(t, err)
+
+	assert.Regexp(t, `Max cpu time\s+7\s+7\s+seconds`, string(procLimits))
+	assert.Regexp(t, `Max address space\s+1073741824\s+1073741824\s+bytes`, string(procLimits))
+
+	// the kernel reports niceness as 20 - nice, so that the result is never negative
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, pid)
+	require.NoError(t, err)
+	assert.Equal(t, 20-5, prio)
+}
+
+func TestLimitsHoldFromTheToolsFirstInstruction(t *testing.T) {
+	cmd, err := buildExecArgv(t.Context(), []string{"sh", "-c", "ulimit -t; cat /proc/self/limits"}, t.TempDir(), types.Language{}, nil)
+	require.NoError(t, err)
+
+	out, _, err := runLimited(cmd, types.Limits{CPUSeconds: 7, MemoryBytes: 1 << 30})
+	require.NoError(t, err)
+
+	// both the tool and what it starts right away
+	assert.Regexp(t, `^7\n`, string(out))
+	assert.Regexp(t, `Max address space\s+1073741824\s+1073741824\s+bytes`, string(out))
+}
+
+func TestInvalidLimitsStartNothing(t *testing.T) {
+	cmd, err := buildExecArgv(t.Context(), []string{"sleep", "30"}, t.TempDir(), types.Language{}, nil)
+	require.NoError(t, err)
+
+	err = startCmd(cmd, types.Limits{IOClass: "fastest"})
+
+	require.ErrorContains(t, err, "fastest")
+	assert.Nil(t, cmd.Process, "the tool must not have been started")
+}
+
+func TestUnappliableLimitsKillTheTool(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root may lower its niceness")
+	}
+	cmd, err := buildExecArgv(t.Context(), []string{"sleep", "30"}, t.TempDir(), types.Language{}, nil)
+	require.NoError(t, err)
+
+	err = startCmd(cmd, types.Limits{Nice: -5})
+
+	require.ErrorContains(t, err, "nice -5")
+	assert.NotNil(t, cmd.ProcessState, "the tool must have been reaped, not left running")
+}
+
+func TestShimFailuresFailTheStart(t *testing.T) {
+	cmd, err := buildExecArgv(t.Context(), []string{"/nonexistent/tool"}, t.TempDir(), types.Language{}, nil)
+	require.NoError(t, err)
+
+	err = startCmd(cmd, types.Limits{CPUSeconds: 7})
+
+	require.ErrorContains(t, err, "/nonexistent/tool")
+	assert.NotNil(t, cmd.ProcessState, "the shim must have been reaped, not left running")
+}
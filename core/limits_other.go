@@ -0,0 +1,28 @@
+//go:build !linux
+
+package core
+
+import (
+	"os/exec"
+	"sync"
+
+	"github.com/konradmalik/flint-ls/logs"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+var warnLimitsUnsupported sync.Once
+
+// startConfined has nothing to apply the limits with outside Linux. The tool runs
+// regardless, since refusing to run it would leave the config working nowhere
+// else; maxOutputBytes is enforced by the reading side and still holds.
+func startConfined(cmd *exec.Cmd, limits types.Limits) error {
+	if limits.MemoryBytes != 0 || limits.CPUSeconds != 0 || limits.Nice != 0 || limits.IOClass != "" {
+		warnLimitsUnsupported.Do(func() {
+			logs.Log.Logln(logs.Warn, "resource limits are only enforced on Linux, ignoring them")
+		})
+	}
+	return cmd.Start()
+}
+
+// ExecLimited has no limits shim to run outside Linux, and always returns.
+func ExecLimited() {}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// TestMain lets the test binary stand in for flint-ls' own as the limits shim.
+func TestMain(m *testing.M) {
+	ExecLimited()
+	os.Exit(m.Run())
+}
+
+func TestValidateLimits(t *testing.T) {
+	assert.NoError(t, validateLimits(types.Limits{IOClass: "idle", IOPriority: 7}))
+	assert.ErrorContains(t, validateLimits(types.Limits{IOClass: "fastest"}), "fastest")
+	assert.ErrorContains(t, validateLimits(types.Limits{IOClass: "best-effort", IOPriority: 8}), "ioPriority")
+}
+
+func TestInheritedEnv(t *testing.T) {
+	t.Setenv("FLINT_LS_KEEP", "1")
+	t.Setenv("FLINT_LS_PREFIXED_A", "2")
+	t.Setenv("FLINT_LS_DROP", "3")
+
+	got := inheritedEnv([]string{"FLINT_LS_KEEP", "FLINT_LS_PREFIXED_*"})
+	assert.Contains(t, got, "FLINT_LS_KEEP=1")
+	assert.Contains(t, got, "FLINT_LS_PREFIXED_A=2")
+	assert.NotContains(t, got, "FLINT_LS_DROP=3")
+
+	assert.Contains(t, inheritedEnv(nil), "FLINT_LS_DROP=3", "no allowlist inherits everything")
+
+	none := inheritedEnv([]string{})
+	assert.NotNil(t, none, "exec.Cmd would read a nil environment as all of ours")
+	assert.Empty(t, none)
+}
+
+func TestEnvAllowlistReachesTheTool(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tool below is env")
+	}
+	t.Setenv("FLINT_LS_SECRET", "hunter2")
+
+	cfg := types.Language{EnvAllowlist: []string{"PATH"}, Env: []string{"FLINT_LS_GIVEN=1"}}
+	cmd, err := buildExecArgv(t.Context(), []string{"env"}, t.TempDir(), cfg, nil)
+	require.NoError(t, err)
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(out), "FLINT_LS_SECRET")
+	assert.Contains(t, string(out), "FLINT_LS_GIVEN=1", "env is the config's own and always set")
+}
+
+func TestRunLimitedKillsAToolPrintingTooMuch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tool below is yes")
+	}
+
+	cmd, err := buildExecArgv(t.Context(), []string{"yes", "spam"}, t.TempDir(), types.Language{}, nil)
+	require.NoError(t, err)
+	out, _, err := runLimited(cmd, types.Limits{MaxOutputBytes: 4096})
+
+	require.ErrorIs(t, err, errOutputLimit)
+	assert.Len(t, out, 4096, "nothing past the ceiling is kept")
+}
+
+func TestLintOutputLimitIsAWarning(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the linter below is yes")
+	}
+
+	dir := t.TempDir()
+	uri := ParseLocalFileToURI(dir + "/a.txt")
+	h := &LangHandler{
+		rootPath: dir,
+		configs: map[string][]types.Language{
+			"vim": {{
+				LintArgs:    []string{"yes", "1:spam"},
+				LintFormats: []string{"%l:%m"},
+				Limits:      types.Limits{MaxOutputBytes: 1 << 16},
+			}},
+		},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {LanguageID: "vim", Text: "hello", NormalizedFilename: dir + "/a.txt", Uri: uri},
+		},
+	}
+
+	reporter := &recordingReporter{}
+	require.NoError(t, h.RunAllLinters(t.Context(), reporter, uri, types.EventTypeChange))
+
+	assert.Empty(t, reporter.errorMessages())
+	require.Len(t, reporter.warningMessages(), 1)
+	assert.Contains(t, reporter.warningMessages()[0], errOutputLimit.Error())
+
+	published := reporter.publishedDiagnostics()
+	assert.NotEmpty(t, published[len(published)-1].Diagnostics,
+		"what the linter printed before it was cut off is still its findings")
+}
+
+func TestLineWriterKeepsLinesWhole(t *testing.T) {
+	var mu sync.Mutex
+	var merged strings.Builder
+	first := &lineWriter{mu: &mu, w: &merged}
+	second := &lineWriter{mu: &mu, w: &merged}
+
+	for _, step := range []struct {
+		w    *lineWriter
+		text string
+	}{
+		{first, "one: st"},
+		{second, "two: whole\n"},
+		{first, "arted\nthree: "},
+		{second, "four: a"},
+	} {
+		_, err := step.w.Write([]byte(step.text))
+		require.NoError(t, err)
+	}
+	require.NoError(t, first.flush())
+	require.NoError(t, second.flush())
+
+	assert.Equal(t, "two: whole\none: started\nthree: four: a", merged.String(),
+		"only the unterminated last lines may run together")
+}
+
+func TestHeadBufferKeepsTheStart(t *testing.T) {
+	b := &headBuffer{max: 5}
+
+	for _, p := range []string{"abc", "defg", "hij"} {
+		n, err := b.Write([]byte(p))
+		require.NoError(t, err)
+		assert.Equal(t, len(p), n, "a short write would stop the copy feeding the buffer")
+	}
+
+	assert.Equal(t, "abcde", b.buf.String())
+}
+
+func TestFormatOutputLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatter below is yes")
+	}
+
+	cmd := exec.CommandContext(t.Context(), "yes")
+	makeCmdKillable(cmd)
+	_, err := runFormattingCommand(cmd, types.Limits{MaxOutputBytes: 1024})
+
+	assert.ErrorIs(t, err, errOutputLimit)
+}
@@ -8,8 +8,10 @@ import (
 	"io"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/konradmalik/flint-ls/logs"
 	"github.com/konradmalik/flint-ls/types"
@@ -21,6 +23,11 @@ var defaultLintFormats = []string{"%f:%l:%m", "%f:%l:%c:%m"}
 // RunAllLinters lints uri with every configured linter that applies to any of
 // events, reporting diagnostics as each linter finishes. It blocks until all
 // linters are done or ctx is cancelled.
+//
+// Every publish carries what the other linters of the document found, in this
+// run or, until they are done, the last one they took part in. So the client
+// never sees the document go blank at the start of a run, and a fast linter
+// reporting first does not take the findings of a slow one away while it works.
 func (h *LangHandler) RunAllLinters(ctx context.Context, reporter Reporter, uri types.DocumentURI, events types.EventType) error {
 	snap, err := h.snapshot(uri)
 	if err != nil {
@@ -28,20 +35,22 @@ func (h *LangHandler) RunAllLinters(ctx context.Context, reporter Reporter, uri
 	}
 	f := snap.file
 
-	configs := snap.resolveConfigs(
-		func(cfg types.Language) bool { return cfg.LintCommand != "" && lintsOnAnyEvent(cfg, events) })
+	all := snap.resolveConfigs(func(cfg types.Language) bool { return cfg.HasLinter() })
+	ids := linterIDs(all)
+
+	var configs []resolvedConfig
+	var configIDs []string
+	for i, cfg := range all {
+		if lintsOnAnyEvent(cfg.Language, events) {
+			configs = append(configs, cfg)
+			configIDs = append(configIDs, ids[i])
+		}
+	}
 	if len(configs) == 0 {
 		logs.Log.Logf(logs.Debug, "no matching lint configs for LanguageID: %v", f.LanguageID)
 		return nil
 	}
 
-	// to reset existing
-	reporter.PublishDiagnostics(ctx, types.PublishDiagnosticsParams{
-		URI:         uri,
-		Diagnostics: make([]types.Diagnostic, 0),
-		Version:     f.Version,
-	})
-
 	progressToken := types.NewProgressToken()
 	reporter.Progress(ctx, types.ProgressParams{
 		Token: progressToken,
@@ -54,41 +63,52 @@ func (h *LangHandler) RunAllLinters(ctx context.Context, reporter Reporter, uri
 		Value: types.NewWorkDoneProgressEnd(nil),
 	})
 
-	// every publish replaces the client's whole set for the document, so each
-	// linter reports the union of what has finished so far rather than only its
-	// own findings -- otherwise the linters would erase each other. mu is held
-	// across the publish as well, which keeps the sets the client sees growing
-	// monotonically instead of letting a smaller one overtake a larger one.
-	var mu sync.Mutex
-	published := make([]types.Diagnostic, 0)
+	publisher := lintPublisher{store: &h.diagnostics, reporter: reporter, uri: uri, version: f.Version, linters: ids, filter: snap.filter, open: h.openFile}
 
 	var wg sync.WaitGroup
-	for _, config := range configs {
+	for i, config := range configs {
 		wg.Go(func() {
-			diagnostics, err := lintDocument(ctx, config.rootPath, f, config.Language)
-			if err != nil {
+			var others *otherDocuments
+			if config.LintReportOtherFiles {
+				others = &otherDocuments{open: func(other types.DocumentURI) (fileRef, bool) {
+					doc, ok := h.openFile(other)
+					// a document no linter is to run on, or this one is not, gets
+					// no findings from it
+					return doc, ok && excludedBy(snap.rootPath, doc.NormalizedFilename, snap.filter.lintExclude) == "" &&
+						excludedBy(snap.rootPath, doc.NormalizedFilename, config.LintExclude) == ""
+				}}
+			}
+
+			streamed := false
+			diagnostics, err := lintDocument(ctx, h.daemons, &h.bases, config.rootPath, f, config.Language,
+				func(sofar []types.Diagnostic) {
+					streamed = true
+					publisher.publish(ctx, configIDs[i], sofar, false)
+				},
+				func(warning string) { reporter.ReportWarning(ctx, warning) },
+				nil, others)
+			switch {
+			case errors.Is(err, errOutputLimit):
+				// what was parsed before the linter was cut off still stands
+				logs.Log.Logln(logs.Warn, err.Error())
+				reporter.ReportWarning(ctx, err.Error())
+			case err != nil:
+				// what the linter found last time stays up: a linter that fails
+				// on a half-typed document is back once it is whole again. What
+				// this run streamed before failing is taken back; one that exited
+				// clean instead publishes its empty findings over it below
 				logs.Log.Logln(logs.Error, err.Error())
 				reporter.ReportError(ctx, err)
+				if streamed {
+					publisher.retract(ctx, configIDs[i])
+				}
 				return
 			}
 
-			// a cancelled run's results describe text the client has already
-			// replaced. it publishes nothing rather than an empty set: killing the
-			// linter left it with no diagnostics to report, and sending those would
-			// wipe out whatever the run that superseded this one has published
-			if ctx.Err() != nil {
-				return
+			publisher.publish(ctx, configIDs[i], diagnostics, true)
+			if others != nil {
+				publisher.publishOthers(ctx, configIDs[i], others.found)
 			}
-
-			mu.Lock()
-			defer mu.Unlock()
-
-			published = append(published, diagnostics...)
-			reporter.PublishDiagnostics(ctx, types.PublishDiagnosticsParams{
-				URI:         uri,
-				Diagnostics: published,
-				Version:     f.Version,
-			})
 		})
 	}
 
@@ -97,50 +117,213 @@ func (h *LangHandler) RunAllLinters(ctx context.Context, reporter Reporter, uri
 	return nil
 }
 
-func lintDocument(ctx context.Context, rootPath string, f fileRef, config types.Language) ([]types.Diagnostic, error) {
-	diagnostics := make([]types.Diagnostic, 0)
-	cmdStr := buildLintCommandString(rootPath, f, config)
+// HasLinters reports whether any linter applies to uri for any of events. A
+// document that is not open has none.
+func (h *LangHandler) HasLinters(uri types.DocumentURI, events types.EventType) bool {
+	snap, err := h.snapshot(uri)
+	if err != nil {
+		return false
+	}
 
-	var stdin io.Reader
-	if config.LintStdin {
-		stdin = strings.NewReader(f.Text)
+	return len(snap.resolveConfigs(
+		func(cfg types.Language) bool { return cfg.HasLinter() && lintsOnAnyEvent(cfg, events) })) > 0
+}
+
+// lintProgressInterval is how often the findings of a linter that is still
+// running are published. The whole set goes out every time, so publishing each
+// diagnostic as it is parsed would cost the client more than the wait saves.
+const lintProgressInterval = 100 * time.Millisecond
+
+// otherDocuments collects what a linter reports about documents other than the
+// one it lints, for lintReportOtherFiles.
+type otherDocuments struct {
+	// returns the document at uri if findings may go to it, which takes it being
+	// open: the client has no use for diagnostics of a file it does not show
+	open func(types.DocumentURI) (fileRef, bool)
+	// what was found in each of them
+	found map[types.DocumentURI][]types.Diagnostic
+}
+
+// document returns the document at uri if findings may go to it. A nil
+// otherDocuments takes none.
+func (o *otherDocuments) document(uri types.DocumentURI) (fileRef, bool) {
+	if o == nil {
+		return fileRef{}, false
 	}
-	cmd := buildExecCmd(ctx, cmdStr, rootPath, config.Env, stdin)
+	return o.open(uri)
+}
 
-	lintOutput, err := runLintCommand(cmd, config)
-	logs.Log.Logln(logs.Info, cmdStr)
-	if logs.Log.Enabled(logs.Debug) {
-		// the output can be large, so it is only copied into a string when
-		// something is actually going to read it
-		logs.Log.Logln(logs.Debug, string(lintOutput))
+func (o *otherDocuments) add(uri types.DocumentURI, d types.Diagnostic) {
+	if o.found == nil {
+		o.found = make(map[types.DocumentURI][]types.Diagnostic)
 	}
+	o.found[uri] = append(o.found[uri], d)
+}
+
+// lintDocument runs a linter over f and returns the diagnostics it found. Its
+// output is parsed as it is printed, and while the linter is still going what it
+// has found so far is handed to progress every lintProgressInterval. Whether
+// those findings count is only known once the linter exits: when its exit code
+// says they do not, what is returned is empty, or an error, and the caller takes
+// back what progress was handed. A non-nil
+// output gets a copy of everything the linter printed, parsed or not. A non-nil
+// others gets what the linter found in the documents it lets through, and the
+// findings in any other file are dropped.
+func lintDocument(ctx context.Context, daemons *daemonPool, bases *gitBases, rootPath string, f fileRef, config types.Language, progress func([]types.Diagnostic), warn func(string), output io.Writer, others *otherDocuments) ([]types.Diagnostic, error) {
+	efms, err := buildErrorformats(config.LintFormats)
 	if err != nil {
 		return nil, err
 	}
 
-	efms, err := buildErrorformats(config.LintFormats)
+	switch config.LintOutputStream {
+	case "", types.OutputStreamStdout, types.OutputStreamStderr, types.OutputStreamBoth:
+	default:
+		return nil, fmt.Errorf("unknown lintOutputStream %q", config.LintOutputStream)
+	}
+	details, err := buildLintDetails(config)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := buildSeverityRules(config.LintSeverityRules)
 	if err != nil {
 		return nil, err
 	}
+	var changed changedLines
+	if config.LintChangedLinesOnly {
+		changed = changedSince(ctx, bases, rootPath, f, config.LintBaseRef, warn)
+	}
+	// what changed in the other documents findings go to, each looked up the
+	// first time one does
+	changedElsewhere := make(map[types.DocumentURI]changedLines)
+	changedIn := func(doc fileRef) changedLines {
+		if !config.LintChangedLinesOnly || doc.Uri == f.Uri {
+			return changed
+		}
+		c, ok := changedElsewhere[doc.Uri]
+		if !ok {
+			c = changedSince(ctx, bases, rootPath, doc, config.LintBaseRef, warn)
+			changedElsewhere[doc.Uri] = c
+		}
+		return c
+	}
+
+	diagnostics := make([]types.Diagnostic, 0)
+	parse := func(printed io.Reader) {
+		if output != nil {
+			printed = io.TeeReader(printed, output)
+		}
+		if logs.Log.Enabled(logs.Debug) {
+			// the output can be large, so it is only copied when something is
+			// actually going to read it
+			var logged strings.Builder
+			printed = io.TeeReader(printed, &logged)
+			defer func() { logs.Log.Logln(logs.Debug, logged.String()) }()
+		}
 
-	efmsScanner := efms.NewScanner(bytes.NewReader(lintOutput))
-	for efmsScanner.Scan() {
-		entry := efmsScanner.Entry()
-		if !entry.Valid {
-			continue
+		lastProgress := time.Now()
+		// the diagnostic a note that follows belongs to, if it is one of ours
+		last := -1
+		efmsScanner := efms.NewScanner(printed)
+		for efmsScanner.Scan() {
+			entry := efmsScanner.Entry()
+			if !entry.Valid {
+				continue
+			}
+
+			entry.Filename = replaceStdinInEntryFilename(entry.Filename, config, f.NormalizedFilename)
+			if config.LintNotesAsRelated && isNote(entry) {
+				// a note may well point somewhere else than the finding it is
+				// about, so it goes wherever that finding goes
+				if last >= 0 {
+					d := &diagnostics[last]
+					d.RelatedInformation = append(slices.Clip(d.RelatedInformation), noteToRelated(entry, rootPath, config, f))
+				}
+				continue
+			}
+			target := f
+			if !isEntryForRequestedURI(rootPath, f.Uri, entry) {
+				// the notes that follow are about a finding that is not ours, and
+				// go nowhere
+				last = -1
+				other, ok := others.document(entryURI(rootPath, entry))
+				if !ok {
+					continue
+				}
+				target = other
+			}
+
+			code := details.takeCode(entry)
+			diagnostic := parseEfmEntryToDiagnostic(entry, config, target)
+			details.fill(&diagnostic, entry, code)
+			diagnostic.RelatedInformation = append(diagnostic.RelatedInformation, details.relatedLines(entry, rootPath, target)...)
+			if !rules.apply(&diagnostic) {
+				// suppressed, and the notes about it along with it
+				last = -1
+				continue
+			}
+			if !changedIn(target).overlaps(diagnostic.Range.Start.Line, diagnostic.Range.End.Line) {
+				// on a line nobody touched, and the notes about it along with it
+				last = -1
+				continue
+			}
+			if target.Uri != f.Uri {
+				others.add(target.Uri, diagnostic)
+				continue
+			}
+			diagnostics = append(diagnostics, diagnostic)
+			last = len(diagnostics) - 1
+
+			if progress != nil && time.Since(lastProgress) >= lintProgressInterval {
+				progress(slices.Clip(diagnostics))
+				lastProgress = time.Now()
+			}
 		}
+	}
 
-		entry.Filename = replaceStdinInEntryFilename(entry.Filename, config, f.NormalizedFilename)
-		if !isEntryForRequestedURI(rootPath, f.Uri, entry) {
-			// entry for a different file, skip
-			continue
+	findings, err := runLinter(ctx, daemons, rootPath, f, config, parse)
+	if !findings {
+		// whatever was parsed, the exit code says it was not about the document
+		return make([]types.Diagnostic, 0), err
+	}
+	return diagnostics, err
+}
+
+// runLinter runs the linter for f, as a process of its own or by asking its
+// daemon, and hands its output to parse. findings reports whether that output
+// was the linter reporting on the document.
+func runLinter(ctx context.Context, daemons *daemonPool, rootPath string, f fileRef, config types.Language, parse func(io.Reader)) (findings bool, err error) {
+	if config.LintDaemon {
+		key := daemonKeyFor(config.LintCommand, config.LintArgs, rootPath)
+		logs.Log.Logf(logs.Info, "%s (daemon)", key)
+
+		resp, err := daemons.request(ctx, key, config,
+			daemonRequest{Filename: f.NormalizedFilename, Text: f.Text})
+		if err != nil {
+			return false, err
 		}
+		parse(bytes.NewReader(daemonLintOutput(resp, config)))
+		return true, nil
+	}
+
+	var stdin io.Reader
+	if config.LintStdin {
+		stdin = strings.NewReader(f.Text)
+	}
 
-		diagnostic := parseEfmEntryToDiagnostic(entry, config, f)
-		diagnostics = append(diagnostics, diagnostic)
+	var cmd *exec.Cmd
+	if len(config.LintArgs) > 0 {
+		argv := buildLintArgv(rootPath, f, config)
+		logs.Log.Logf(logs.Info, "%q", argv)
+		if cmd, err = buildExecArgv(ctx, argv, rootPath, config, stdin); err != nil {
+			return false, err
+		}
+	} else {
+		cmdStr := buildLintCommandString(rootPath, f, config)
+		cmd = buildExecCmd(ctx, cmdStr, rootPath, config, stdin)
+		logs.Log.Logln(logs.Info, cmdStr)
 	}
 
-	return diagnostics, nil
+	return runLintCommand(cmd, config, parse)
 }
 
 var severityByLintType = map[rune]types.DiagnosticSeverity{
@@ -154,11 +337,20 @@ var severityByLintType = map[rune]types.DiagnosticSeverity{
 	'n': types.DiagHint,
 }
 
-func getSeverity(typ rune, categoryMap map[string]string, defaultSeverity types.DiagnosticSeverity) types.DiagnosticSeverity {
+func getSeverity(typ rune, code *types.DiagnosticCode, categoryMap map[string]string, defaultSeverity types.DiagnosticSeverity) types.DiagnosticSeverity {
 	// we allow the config to provide a mapping between LSP types E,W,I,N and whatever categories the linter has.
 	// a category the config does not mention keeps whatever the linter reported: a partial mapping is a
-	// perfectly reasonable config, and it must not decide the severity of categories it says nothing about
-	if mapped := categoryMap[string(typ)]; mapped != "" {
+	// perfectly reasonable config, and it must not decide the severity of categories it says nothing about.
+	// the finding's code is a category too, and the more specific one: a linter that reports every finding as
+	// an error can still have some of its rules mapped to warnings
+	mapped := ""
+	if code != nil {
+		mapped = categoryMap[code.String()]
+	}
+	if mapped == "" {
+		mapped = categoryMap[string(typ)]
+	}
+	if mapped != "" {
 		typ = []rune(mapped)[0]
 	}
 
@@ -174,9 +366,12 @@ func getSeverity(typ rune, categoryMap map[string]string, defaultSeverity types.
 
 // lintsOnAnyEvent reports whether cfg wants to run for any of the events the run
 // covers. Linting on open, change and save is all on unless the config turns it
-// off.
+// off, and a run somebody asked for runs every linter: turning the events off is
+// how a linter too slow for anything else is kept for when it is asked for.
 func lintsOnAnyEvent(cfg types.Language, events types.EventType) bool {
 	switch {
+	case events&types.EventTypeCommand != 0:
+		return true
 	case events&types.EventTypeOpen != 0 && boolOrDefault(cfg.LintAfterOpen, true):
 		return true
 	case events&types.EventTypeChange != 0 && boolOrDefault(cfg.LintOnChange, true):
@@ -208,30 +403,64 @@ func buildLintCommandString(rootPath string, f fileRef, config types.Language) s
 	return replaceMagicStrings(command, f.NormalizedFilename, rootPath)
 }
 
-// runLintCommand runs a linter and returns the output that is worth parsing for
-// diagnostics, which is not the same thing as everything it printed.
-func runLintCommand(cmd *exec.Cmd, config types.Language) ([]byte, error) {
-	lintOutput, lintCmdError := cmd.CombinedOutput()
+// buildLintArgv is buildLintCommandString for a linter run without a shell: the
+// filename goes in as an argument of its own when the config does not place it.
+func buildLintArgv(rootPath string, f fileRef, config types.Language) []string {
+	args := config.LintArgs
+	if !config.LintStdin && !slices.ContainsFunc(args, func(arg string) bool { return strings.Contains(arg, inputPlaceholder) }) {
+		args = append(slices.Clip(args), inputPlaceholder)
+	}
+	return replaceMagicArgs(args, f.NormalizedFilename, rootPath)
+}
+
+// the exit codes a POSIX shell uses for a command it found but could not run, and
+// for one it could not find
+const (
+	exitCannotExecute = 126
+	exitNotFound      = 127
+)
+
+// toolError is the error reported for a tool that failed to run, explained by
+// what it said on stderr: stdout is where a linter that did run puts findings,
+// which are no help in working out why it did not.
+func toolError(err error, stderr []byte) error {
+	if stderr := bytes.TrimSpace(stderr); len(stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, stderr)
+	}
+	return err
+}
+
+// runLintCommand runs a linter, streaming everything it prints to parse, and
+// reports whether that output is worth keeping as diagnostics -- which is not
+// the same thing as the linter having printed something.
+func runLintCommand(cmd *exec.Cmd, config types.Language, parse func(io.Reader)) (findings bool, err error) {
+	stderr, lintCmdError := streamLimited(cmd, config.Limits, config.LintOutputStream, parse)
 
 	var exitErr *exec.ExitError
 	switch {
+	case errors.Is(lintCmdError, errOutputLimit):
+		// killed for printing too much, but what it printed before that is as
+		// good as it ever was
+		return true, lintCmdError
 	case lintCmdError == nil:
 		// the linter found nothing to complain about -- unless the config says
 		// this linter exits 0 even when it did have something to say
-		if config.LintIgnoreExitCode {
-			return lintOutput, nil
-		}
-		return nil, nil
+		return config.LintIgnoreExitCode, nil
 	case !errors.As(lintCmdError, &exitErr):
 		// the linter never ran, or something failed that is not the linter
 		// telling us about the document
-		return lintOutput, lintCmdError
+		return false, toolError(lintCmdError, stderr)
 	case exitErr.ExitCode() < 0:
 		// killed rather than exited: superseded by a newer run, or shutting down
-		return nil, nil
+		return false, nil
+	case len(config.LintArgs) == 0 && (exitErr.ExitCode() == exitCannotExecute || exitErr.ExitCode() == exitNotFound):
+		// the shell telling us it could not run the linter, which is no more a
+		// finding than the linter failing to start without one. Without a shell
+		// there is nobody to say so, and these are codes like any other
+		return false, toolError(lintCmdError, stderr)
 	default:
 		// a non-zero exit is how a linter reports that it found something
-		return lintOutput, nil
+		return true, nil
 	}
 }
 
@@ -248,13 +477,16 @@ func isEntryForRequestedURI(rootPath string, uri types.DocumentURI, entry *error
 		return true
 	}
 	// if entry.Filename is not empty, we need to check if this entry is indeed for this uri
-	var diagURI types.DocumentURI
+	return comparePaths(string(entryURI(rootPath, entry)), string(uri))
+}
+
+// entryURI is the URI of the file entry names, which a relative name gives
+// relative to the linter's root.
+func entryURI(rootPath string, entry *errorformat.Entry) types.DocumentURI {
 	if filepath.IsAbs(entry.Filename) {
-		diagURI = ParseLocalFileToURI(entry.Filename)
-	} else {
-		diagURI = ParseLocalFileToURI(filepath.Join(rootPath, entry.Filename))
+		return ParseLocalFileToURI(entry.Filename)
 	}
-	return comparePaths(string(diagURI), string(uri))
+	return ParseLocalFileToURI(filepath.Join(rootPath, entry.Filename))
 }
 
 func parseEfmEntryToDiagnostic(entry *errorformat.Entry, config types.Language, f fileRef) types.Diagnostic {
@@ -274,6 +506,10 @@ func parseEfmEntryToDiagnostic(entry *errorformat.Entry, config types.Language,
 	// entry.Col is expected to be one based
 	// if the linter reports 0 it means the whole line
 	if entry.Col != 0 {
+		if entry.Vcol {
+			// %v and %p count screen columns, where a tab takes up to 8 of them
+			colStart = virtualColumnUtf16(f.Text, lineStart, colStart)
+		}
 		// We only add the offset if the linter reports entry.Col > 0 because 0 means the whole line
 		colStart = colStart + config.LintOffsetColumns
 
@@ -286,8 +522,15 @@ func parseEfmEntryToDiagnostic(entry *errorformat.Entry, config types.Language,
 				colEnd = max(colEnd, colStart)
 			}
 		} else {
-			colEnd = WordEndUtf16(f.Text, types.Position{Line: lineStart, Character: colStart})
+			colEnd = rangeEndUtf16(f.Text, types.Position{Line: lineStart, Character: colStart}, config.LintRangeMode, config.LintSymbolPattern)
 		}
+	} else if config.LintRangeMode == types.RangeModeLine && entry.EndLnum == 0 {
+		colEnd = rangeEndUtf16(f.Text, types.Position{Line: lineStart}, config.LintRangeMode, "")
+	}
+
+	var code *types.DiagnosticCode
+	if entry.Nr != 0 {
+		code = types.IntCode(entry.Nr)
 	}
 
 	return types.Diagnostic{
@@ -295,9 +538,9 @@ func parseEfmEntryToDiagnostic(entry *errorformat.Entry, config types.Language,
 			Start: types.Position{Line: lineStart, Character: colStart},
 			End:   types.Position{Line: lineEnd, Character: colEnd},
 		},
-		Code:     intPtrIfNotZero(entry.Nr),
+		Code:     code,
 		Message:  getLintMessagePrefix(config) + entry.Text,
-		Severity: getSeverity(entry.Type, config.LintCategoryMap, config.LintSeverity),
+		Severity: getSeverity(entry.Type, code, config.LintCategoryMap, config.LintSeverity),
 		Source:   getLintSource(config),
 	}
 }
@@ -141,7 +141,10 @@ func TestLinting(t *testing.T) {
 	}
 }
 
-func TestDiagnosticsResetOnEachRun(t *testing.T) {
+// TestDiagnosticsAreNotResetOnEachRun covers the start of a run, which used to
+// clear the document's diagnostics and left the client showing none until the
+// linters were done.
+func TestDiagnosticsAreNotResetOnEachRun(t *testing.T) {
 	base, _ := os.Getwd()
 	file := filepath.Join(base, "foo")
 	uri := ParseLocalFileToURI(file)
@@ -170,9 +173,8 @@ func TestDiagnosticsResetOnEachRun(t *testing.T) {
 	pd, err := h.getAllPublishDiagnosticsParamsForUriWithEvent(t, uri, types.EventTypeSave)
 	assert.NoError(t, err)
 
-	assert.Len(t, pd, 2)
-	assert.Empty(t, pd[0].Diagnostics)
-	assert.NotEmpty(t, pd[1].Diagnostics)
+	require.Len(t, pd, 1, "the linter's result is the only publish")
+	assert.NotEmpty(t, pd[0].Diagnostics)
 }
 
 // TestDiagnosticsOfEveryLinterSurvive covers a document linted by more than one
@@ -215,13 +217,12 @@ func TestDiagnosticsOfEveryLinterSurvive(t *testing.T) {
 	pd, err := h.getAllPublishDiagnosticsParamsForUriWithEvent(t, uri, types.EventTypeSave)
 	assert.NoError(t, err)
 
-	// the reset, then one publish per linter
-	require.Len(t, pd, 3)
-	assert.Empty(t, pd[0].Diagnostics)
-	assert.Len(t, pd[1].Diagnostics, 1, "the first linter to finish reports what it found")
+	// one publish per linter
+	require.Len(t, pd, 2)
+	assert.Len(t, pd[0].Diagnostics, 1, "the first linter to finish reports what it found")
 
 	messages := make([]string, 0, 2)
-	for _, d := range pd[2].Diagnostics {
+	for _, d := range pd[1].Diagnostics {
 		messages = append(messages, d.Message)
 	}
 	slices.Sort(messages)
@@ -285,9 +286,266 @@ func TestSupersededRunPublishesNothing(t *testing.T) {
 	cancel()
 	require.NoError(t, <-done)
 
-	published := reporter.publishedDiagnostics()
-	require.Len(t, published, 1, "a cancelled run must publish nothing beyond its initial reset")
-	assert.Empty(t, published[0].Diagnostics)
+	assert.Empty(t, reporter.publishedDiagnostics(), "a cancelled run must publish nothing")
+}
+
+// TestSlowLinterPublishesAsItGoes covers a linter that takes its time: what it
+// has printed so far reaches the client before it exits.
+func TestSlowLinterPublishesAsItGoes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	base := t.TempDir()
+	file := filepath.Join(base, "foo")
+	uri := ParseLocalFileToURI(file)
+
+	h := &LangHandler{
+		rootPath: base,
+		configs: map[string][]types.Language{
+			"vim": {
+				{
+					LintCommand:        `echo 1:first; sleep 0.3; echo 2:second; sleep 0.3; echo 3:third`,
+					LintFormats:        []string{"%l:%m"},
+					LintIgnoreExitCode: true,
+					LintStdin:          true,
+				},
+			},
+		},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {
+				LanguageID:         "vim",
+				Text:               "one\ntwo\nthree\n",
+				NormalizedFilename: file,
+				Uri:                uri,
+			},
+		},
+	}
+
+	pd, err := h.getAllPublishDiagnosticsParamsForUriWithEvent(t, uri, types.EventTypeChange)
+	require.NoError(t, err)
+
+	counts := make([]int, 0, len(pd))
+	for _, p := range pd {
+		counts = append(counts, len(p.Diagnostics))
+	}
+	require.Greater(t, len(counts), 1, "nothing was published before the linter finished: %v", counts)
+	assert.Less(t, counts[0], 3, "the first publish came only once everything was in: %v", counts)
+	assert.Equal(t, 3, counts[len(counts)-1], "the last publish is what the client keeps: %v", counts)
+	assert.True(t, slices.IsSorted(counts), "the published set shrank while the linter ran: %v", counts)
+}
+
+// TestLinterHeededForItsExitCodeTakesBackWhatItStreamed covers a slow linter
+// whose findings only count if it exits non-zero. What it prints is published as
+// it goes like any other linter's, and the exit code decides what stays.
+func TestLinterHeededForItsExitCodeTakesBackWhatItStreamed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	base := t.TempDir()
+	file := filepath.Join(base, "foo")
+	uri := ParseLocalFileToURI(file)
+
+	h := &LangHandler{
+		rootPath: base,
+		configs: map[string][]types.Language{
+			"vim": {
+				{
+					LintCommand: `echo 1:first; sleep 0.3; echo 2:second; sleep 0.3`,
+					LintFormats: []string{"%l:%m"},
+					LintStdin:   true,
+				},
+			},
+		},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {LanguageID: "vim", Text: "one\ntwo\n", NormalizedFilename: file, Uri: uri},
+		},
+	}
+
+	pd, err := h.getAllPublishDiagnosticsParamsForUriWithEvent(t, uri, types.EventTypeChange)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, pd)
+	assert.True(t, slices.ContainsFunc(pd, func(p types.PublishDiagnosticsParams) bool { return len(p.Diagnostics) > 0 }),
+		"nothing was published while the linter was running")
+	// it exited 0, so what it printed was not about the document
+	assert.Empty(t, pd[len(pd)-1].Diagnostics, "the findings the exit code voided were left up")
+}
+
+// TestFailedLinterTakesBackWhatItStreamed covers a slow linter that fails after
+// it has printed findings, which do not stand any more than those of a linter
+// that fails at once.
+func TestFailedLinterTakesBackWhatItStreamed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	base := t.TempDir()
+	file := filepath.Join(base, "foo")
+	uri := ParseLocalFileToURI(file)
+
+	h := &LangHandler{
+		rootPath: base,
+		configs: map[string][]types.Language{
+			"vim": {
+				{
+					LintCommand: `echo 1:first; sleep 0.3; echo 2:second; sleep 0.3; exit 127`,
+					LintFormats: []string{"%l:%m"},
+					LintStdin:   true,
+				},
+			},
+		},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {LanguageID: "vim", Text: "one\ntwo\n", NormalizedFilename: file, Uri: uri},
+		},
+	}
+
+	reporter := &recordingReporter{}
+	require.NoError(t, h.RunAllLinters(t.Context(), reporter, uri, types.EventTypeChange))
+	require.NotEmpty(t, reporter.errorMessages(), "the linter failing went unreported")
+
+	pd := reporter.publishedDiagnostics()
+	require.NotEmpty(t, pd)
+	assert.True(t, slices.ContainsFunc(pd, func(p types.PublishDiagnosticsParams) bool { return len(p.Diagnostics) > 0 }),
+		"nothing was published while the linter was running")
+	assert.Empty(t, pd[len(pd)-1].Diagnostics, "what the failed run streamed was left up")
+}
+
+// TestOverlongLineDoesNotStallTheLinter covers a line longer than the errorformat
+// scanner takes, which ends the scan early. The rest of the output still has to be
+// read, or the linter blocks on a full pipe and the run with it.
+func TestOverlongLineDoesNotStallTheLinter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	base := t.TempDir()
+	file := filepath.Join(base, "foo")
+	uri := ParseLocalFileToURI(file)
+
+	h := &LangHandler{
+		rootPath: base,
+		configs: map[string][]types.Language{
+			"vim": {
+				{
+					LintCommand:        `echo 1:before; head -c 1000000 /dev/zero | tr '\0' x; echo; yes 2:after | head -n 100000`,
+					LintFormats:        []string{"%l:%m"},
+					LintIgnoreExitCode: true,
+					LintStdin:          true,
+				},
+			},
+		},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {LanguageID: "vim", Text: "one\ntwo\n", NormalizedFilename: file, Uri: uri},
+		},
+	}
+
+	d, err := h.getAllDiagnosticsForUri(t, uri)
+	require.NoError(t, err)
+	assert.NotEmpty(t, d)
+	assert.Equal(t, "before", d[0].Message)
+}
+
+func TestLintOutputStream(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	tests := []struct {
+		stream types.OutputStream
+		want   []string
+	}{
+		{"", []string{"from stderr", "from stdout"}},
+		{types.OutputStreamBoth, []string{"from stderr", "from stdout"}},
+		{types.OutputStreamStdout, []string{"from stdout"}},
+		{types.OutputStreamStderr, []string{"from stderr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.stream), func(t *testing.T) {
+			h, uri := newStreamTestHandler(t, types.Language{
+				LintCommand:        `echo 1:from stdout; echo 2:from stderr >&2`,
+				LintFormats:        []string{"%l:%m"},
+				LintIgnoreExitCode: true,
+				LintStdin:          true,
+				LintOutputStream:   tt.stream,
+			})
+
+			d, err := h.getAllDiagnosticsForUri(t, uri)
+			require.NoError(t, err)
+
+			messages := make([]string, 0, len(d))
+			for _, diagnostic := range d {
+				messages = append(messages, diagnostic.Message)
+			}
+			slices.Sort(messages)
+			assert.Equal(t, tt.want, messages)
+		})
+	}
+}
+
+func TestLintOutputStreamMustBeKnown(t *testing.T) {
+	h, uri := newStreamTestHandler(t, types.Language{LintCommand: "true", LintOutputStream: "stdin"})
+
+	_, err := h.getAllDiagnosticsForUri(t, uri)
+	assert.ErrorContains(t, err, `unknown lintOutputStream "stdin"`)
+}
+
+// TestLinterThatCannotRunIsExplainedByStderr covers a linter the shell could not
+// run: that is an error, not a finding, and what explains it is on stderr rather
+// than among whatever the command printed on stdout.
+func TestLinterThatCannotRunIsExplainedByStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	h, uri := newStreamTestHandler(t, types.Language{
+		LintCommand: `echo 1:noise; echo no such linter >&2; exit 127`,
+		LintFormats: []string{"%l:%m"},
+		LintStdin:   true,
+	})
+
+	d, err := h.getAllDiagnosticsForUri(t, uri)
+	require.ErrorContains(t, err, "no such linter")
+	assert.NotContains(t, err.Error(), "noise")
+	assert.Empty(t, d)
+}
+
+// TestLinterRunWithoutAShellMayExit127 covers the same exit code from a linter
+// run without a shell, where it is the linter's own and means what any other
+// non-zero exit does.
+func TestLinterRunWithoutAShellMayExit127(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the linter below is a POSIX shell")
+	}
+
+	h, uri := newStreamTestHandler(t, types.Language{
+		LintArgs:    []string{"sh", "-c", "echo 1:finding; exit 127"},
+		LintFormats: []string{"%l:%m"},
+		LintStdin:   true,
+	})
+
+	d, err := h.getAllDiagnosticsForUri(t, uri)
+	require.NoError(t, err)
+	require.Len(t, d, 1)
+	assert.Equal(t, "finding", d[0].Message)
+}
+
+func newStreamTestHandler(t *testing.T, config types.Language) (*LangHandler, types.DocumentURI) {
+	t.Helper()
+
+	base := t.TempDir()
+	file := filepath.Join(base, "foo")
+	uri := ParseLocalFileToURI(file)
+
+	return &LangHandler{
+		rootPath: base,
+		configs:  map[string][]types.Language{"vim": {config}},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {LanguageID: "vim", Text: "one\ntwo\n", NormalizedFilename: file, Uri: uri},
+		},
+	}, uri
 }
 
 // TestLintPathNeedingQuoting covers a filename that the shell would mangle if it
@@ -331,6 +589,79 @@ func TestLintPathNeedingQuoting(t *testing.T) {
 	assert.Equal(t, "hello", d[0].Message)
 }
 
+func TestLintArgsPassTheFilenameAsIs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the linter below is cat")
+	}
+
+	dir := t.TempDir()
+	// everything in here means something to a shell, and nothing to cat
+	file := filepath.Join(dir, "$(echo hi) `x` & 'y' \"z\".txt")
+	require.NoError(t, os.WriteFile(file, []byte("1:hello"), 0o600))
+	uri := ParseLocalFileToURI(file)
+
+	h := &LangHandler{
+		rootPath: dir,
+		configs: map[string][]types.Language{
+			"vim": {
+				{
+					LintArgs:           []string{"cat"},
+					LintFormats:        []string{"%l:%m"},
+					LintIgnoreExitCode: true,
+				},
+			},
+		},
+		files: map[types.DocumentURI]*fileRef{
+			uri: {
+				LanguageID:         "vim",
+				Text:               "1:hello",
+				NormalizedFilename: filepath.ToSlash(file),
+				Uri:                uri,
+			},
+		},
+	}
+
+	d, err := h.getAllDiagnosticsForUri(t, uri)
+	require.NoError(t, err)
+	require.Len(t, d, 1)
+	assert.Equal(t, "hello", d[0].Message)
+}
+
+func TestBuildLintArgv(t *testing.T) {
+	f := fileRef{NormalizedFilename: efmlsFile, LanguageID: "test", Text: efmlsText}
+
+	tests := []struct {
+		name   string
+		config types.Language
+		want   []string
+	}{
+		{
+			name:   "the filename is appended when the config does not place it",
+			config: types.Language{LintArgs: []string{"lint", "--quiet"}},
+			want:   []string{"lint", "--quiet", efmlsFile},
+		},
+		{
+			name:   "placeholders are filled without quoting",
+			config: types.Language{LintArgs: []string{"lint", "--config=${ROOT}/lint.toml", "${INPUT}"}},
+			want:   []string{"lint", "--config=" + efmlsRoot + "/lint.toml", efmlsFile},
+		},
+		{
+			name:   "a linter reading stdin is given no filename it did not ask for",
+			config: types.Language{LintArgs: []string{"lint", "-"}, LintStdin: true},
+			want:   []string{"lint", "-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := slices.Clone(tt.config.LintArgs)
+
+			assert.Equal(t, tt.want, buildLintArgv(efmlsRoot, f, tt.config))
+			assert.Equal(t, args, tt.config.LintArgs, "the config itself must be left alone")
+		})
+	}
+}
+
 func TestLintFileMatchedWildcard(t *testing.T) {
 	base, _ := os.Getwd()
 	file := filepath.Join(base, "foo")
@@ -717,6 +1048,12 @@ func TestLintEventTypes(t *testing.T) {
 			lintOnChange:   false,
 			expectMessages: 0,
 		},
+		// a linter set to run on no event is one kept for when it is asked for
+		{
+			name:           "a command runs a linter that wants no event",
+			event:          types.EventTypeCommand,
+			expectMessages: 1,
+		},
 	}
 
 	for _, tt := range tests {
@@ -731,30 +1068,53 @@ func TestLintEventTypes(t *testing.T) {
 	}
 }
 
+func TestHasLinters(t *testing.T) {
+	uri := ParseLocalFileToURI(filepath.Join(t.TempDir(), "a.txt"))
+	onSaveOnly := false
+	h := NewHandler(map[string][]types.Language{
+		"linted":    {{LintCommand: "lint", LintAfterOpen: &onSaveOnly, LintOnChange: &onSaveOnly}},
+		"formatted": {{FormatCommand: "format"}},
+	})
+	t.Cleanup(h.Close)
+
+	assert.False(t, h.HasLinters(uri, types.EventTypeSave), "a document that is not open has none")
+
+	require.NoError(t, h.OpenFile(uri, "linted", 1, ""))
+	assert.True(t, h.HasLinters(uri, types.EventTypeSave))
+	assert.False(t, h.HasLinters(uri, types.EventTypeChange|types.EventTypeOpen))
+
+	require.NoError(t, h.OpenFile(uri, "formatted", 1, ""))
+	assert.False(t, h.HasLinters(uri, types.EventTypeSave))
+}
+
 func TestGetSeverity(t *testing.T) {
 	tests := []struct {
 		name            string
 		typ             rune
+		code            *types.DiagnosticCode
 		categoryMap     map[string]string
 		defaultSeverity types.DiagnosticSeverity
 		want            types.DiagnosticSeverity
 	}{
-		{"Error type", 'E', nil, 0, types.DiagError},
-		{"Warning type", 'W', nil, 0, types.DiagWarning},
-		{"Info type", 'I', nil, 0, types.DiagInformation},
-		{"Hint type", 'N', nil, 0, types.DiagHint},
-		{"Default severity overrides", 'X', nil, types.DiagWarning, types.DiagWarning},
-		{"Category map remap", 'X', map[string]string{"X": "W"}, 0, types.DiagWarning},
+		{"Error type", 'E', nil, nil, 0, types.DiagError},
+		{"Warning type", 'W', nil, nil, 0, types.DiagWarning},
+		{"Info type", 'I', nil, nil, 0, types.DiagInformation},
+		{"Hint type", 'N', nil, nil, 0, types.DiagHint},
+		{"Default severity overrides", 'X', nil, nil, types.DiagWarning, types.DiagWarning},
+		{"Category map remap", 'X', nil, map[string]string{"X": "W"}, 0, types.DiagWarning},
 		// a config that maps only some of its linter's categories is fine: the
 		// ones it says nothing about keep what the linter reported
-		{"Category map without the reported type", 'W', map[string]string{"R": "I"}, 0, types.DiagWarning},
-		{"Category map without the reported type falls back to the default", 'X', map[string]string{"R": "I"}, types.DiagHint, types.DiagHint},
-		{"Category map with an empty mapping", 'W', map[string]string{"W": ""}, 0, types.DiagWarning},
-		{"No type reported at all", 0, map[string]string{"R": "I"}, 0, types.DiagError},
+		{"Category map without the reported type", 'W', nil, map[string]string{"R": "I"}, 0, types.DiagWarning},
+		{"Category map without the reported type falls back to the default", 'X', nil, map[string]string{"R": "I"}, types.DiagHint, types.DiagHint},
+		{"Category map with an empty mapping", 'W', nil, map[string]string{"W": ""}, 0, types.DiagWarning},
+		{"No type reported at all", 0, nil, map[string]string{"R": "I"}, 0, types.DiagError},
+		{"Category map keyed by the code", 'E', types.StringCode("E501"), map[string]string{"E501": "N"}, 0, types.DiagHint},
+		{"The code is the more specific category", 'E', types.StringCode("E501"), map[string]string{"E": "W", "E501": "I"}, 0, types.DiagInformation},
+		{"A code the map does not mention falls back to the type", 'E', types.IntCode(101), map[string]string{"E": "W", "E501": "I"}, 0, types.DiagWarning},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := getSeverity(tt.typ, tt.categoryMap, tt.defaultSeverity)
+			got := getSeverity(tt.typ, tt.code, tt.categoryMap, tt.defaultSeverity)
 			assert.Equal(t, tt.want, got)
 		})
 	}
@@ -1041,6 +1401,79 @@ func TestParseEfmEntryToDiagnostic(t *testing.T) {
 	}
 }
 
+func TestLintRangeMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	file := filepath.Join(t.TempDir(), "foo.sh")
+	f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: "echo $HOME/bin\n\tfor x in $y; do\n"}
+	lint := func(t *testing.T, config types.Language) []types.Range {
+		t.Helper()
+
+		config.LintStdin = true
+		config.LintIgnoreExitCode = true
+		diagnostics, err := lintDocument(t.Context(), nil, nil, filepath.Dir(file), f, config, nil, nil, nil, nil)
+		require.NoError(t, err)
+
+		ranges := make([]types.Range, 0)
+		for _, d := range diagnostics {
+			ranges = append(ranges, d.Range)
+		}
+		return ranges
+	}
+	at := func(line, start, end int) types.Range {
+		return types.Range{Start: types.Position{Line: line, Character: start}, End: types.Position{Line: line, Character: end}}
+	}
+
+	t.Run("modes", func(t *testing.T) {
+		tests := []struct {
+			mode   types.RangeMode
+			symbol string
+			want   []types.Range
+		}{
+			{"", "", []types.Range{at(0, 5, 6), at(1, 0, 0)}},
+			{types.RangeModeWord, "", []types.Range{at(0, 5, 6), at(1, 0, 0)}},
+			{types.RangeModeLine, "", []types.Range{at(0, 5, 14), at(1, 0, 16)}},
+			{types.RangeModePoint, "", []types.Range{at(0, 5, 5), at(1, 0, 0)}},
+			{types.RangeModeSymbol, "", []types.Range{at(0, 5, 10), at(1, 0, 0)}},
+			{types.RangeModeSymbol, `[\w$/]`, []types.Range{at(0, 5, 14), at(1, 0, 0)}},
+			{types.RangeModeUntilWhitespace, "", []types.Range{at(0, 5, 14), at(1, 0, 0)}},
+		}
+
+		for _, tt := range tests {
+			t.Run(string(tt.mode)+tt.symbol, func(t *testing.T) {
+				assert.Equal(t, tt.want, lint(t, types.Language{
+					// a finding with a column, and one without
+					LintCommand:       `printf '%s\n' '1:6:unquoted' '2:0:loop'`,
+					LintFormats:       []string{"%l:%c:%m"},
+					LintRangeMode:     tt.mode,
+					LintSymbolPattern: tt.symbol,
+				}))
+			})
+		}
+	})
+
+	t.Run("screen columns", func(t *testing.T) {
+		// the line is indented with a tab, so the ninth screen column is its
+		// second character, and the pointer under $y is at the eighteenth
+		assert.Equal(t, []types.Range{at(1, 1, 4), at(1, 10, 11)}, lint(t, types.Language{
+			LintCommand: `printf '%s\n' '2:9:keyword' '2: unquoted' '                 ^'`,
+			LintFormats: []string{"%l:%v:%m", "%E%l: %m", "%C%p^"},
+		}))
+	})
+}
+
+func TestLintRangeModeErrors(t *testing.T) {
+	f := fileRef{NormalizedFilename: "foo", Uri: ParseLocalFileToURI("foo")}
+
+	_, err := lintDocument(t.Context(), nil, nil, "", f, types.Language{LintCommand: "true", LintRangeMode: "token"}, nil, nil, nil, nil)
+	assert.ErrorContains(t, err, `unknown lintRangeMode "token"`)
+
+	_, err = lintDocument(t.Context(), nil, nil, "", f, types.Language{LintCommand: "true", LintRangeMode: types.RangeModeSymbol, LintSymbolPattern: "["}, nil, nil, nil, nil)
+	assert.ErrorContains(t, err, "invalid lintSymbolPattern")
+}
+
 func (h *LangHandler) getAllDiagnosticsForUri(t *testing.T, uri types.DocumentURI) ([]types.Diagnostic, error) {
 	return h.getAllDiagnosticsForUriWithEvent(t, uri, types.EventTypeChange)
 }
@@ -1077,6 +1510,7 @@ type recordingReporter struct {
 	diagnostics []types.PublishDiagnosticsParams
 	progress    []types.ProgressParams
 	errors      []error
+	warnings    []string
 }
 
 func (r *recordingReporter) PublishDiagnostics(_ context.Context, params types.PublishDiagnosticsParams) {
@@ -1097,6 +1531,18 @@ func (r *recordingReporter) ReportError(_ context.Context, err error) {
 	r.errors = append(r.errors, err)
 }
 
+func (r *recordingReporter) ReportWarning(_ context.Context, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.warnings = append(r.warnings, message)
+}
+
+func (r *recordingReporter) warningMessages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.warnings)
+}
+
 func (r *recordingReporter) publishedDiagnostics() []types.PublishDiagnosticsParams {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -21,4 +21,8 @@ type Reporter interface {
 	// written to the local log by the caller, so implementations should only
 	// forward them to the client.
 	ReportError(ctx context.Context, err error)
+	// ReportWarning surfaces something the user should know about a run that
+	// still produced results, such as a tool cut off by its output limit. Like
+	// errors, warnings are already in the local log.
+	ReportWarning(ctx context.Context, message string)
 }
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// severityRule is a types.SeverityRule with its patterns compiled. A nil pattern
+// matches anything.
+type severityRule struct {
+	code, message, source *regexp.Regexp
+	severity              types.DiagnosticSeverity
+	suppress              bool
+}
+
+// severityRules are a config's lintSeverityRules, in order.
+type severityRules []severityRule
+
+func buildSeverityRules(configured []types.SeverityRule) (severityRules, error) {
+	rules := make(severityRules, 0, len(configured))
+	for i, rule := range configured {
+		if !rule.Suppress && (rule.Severity < types.DiagError || rule.Severity > types.DiagHint) {
+			return nil, fmt.Errorf("lintSeverityRules[%d]: severity has to be 1 to 4, unless the rule suppresses", i)
+		}
+
+		compiled := severityRule{severity: rule.Severity, suppress: rule.Suppress}
+		for _, p := range []struct {
+			field   string
+			pattern string
+			whole   bool
+			re      **regexp.Regexp
+		}{
+			{"code", rule.Code, true, &compiled.code},
+			{"message", rule.Message, false, &compiled.message},
+			{"source", rule.Source, true, &compiled.source},
+		} {
+			if p.pattern == "" {
+				continue
+			}
+			pattern := p.pattern
+			if p.whole {
+				pattern = `^(?:` + pattern + `)$`
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("lintSeverityRules[%d]: invalid %s pattern %q: %w", i, p.field, p.pattern, err)
+			}
+			*p.re = re
+		}
+
+		rules = append(rules, compiled)
+	}
+
+	return rules, nil
+}
+
+// apply sets the severity of d as the first rule matching it says, and reports
+// whether d is to be kept at all. A finding no rule matches is kept as it is.
+func (r severityRules) apply(d *types.Diagnostic) bool {
+	var code, source string
+	if d.Code != nil {
+		code = d.Code.String()
+	}
+	if d.Source != nil {
+		source = *d.Source
+	}
+
+	for _, rule := range r {
+		if !matchesOrUnset(rule.code, code) || !matchesOrUnset(rule.message, d.Message) || !matchesOrUnset(rule.source, source) {
+			continue
+		}
+
+		if rule.suppress {
+			return false
+		}
+		d.Severity = rule.severity
+		return true
+	}
+
+	return true
+}
+
+func matchesOrUnset(re *regexp.Regexp, s string) bool {
+	return re == nil || re.MatchString(s)
+}
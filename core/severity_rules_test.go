@@ -0,0 +1,99 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestSeverityRules(t *testing.T) {
+	rules, err := buildSeverityRules([]types.SeverityRule{
+		{Code: "E501", Severity: types.DiagHint},
+		{Message: "TODO", Severity: types.DiagInformation},
+		{Code: "E1.*", Suppress: true},
+		{Source: "mypy", Message: "^note:", Suppress: true},
+		// never reached for E1xx, which the rule before drops
+		{Code: "E1.*", Severity: types.DiagWarning},
+	})
+	require.NoError(t, err)
+
+	ruff, mypy := "ruff", "mypy"
+	tests := []struct {
+		name       string
+		diagnostic types.Diagnostic
+		wantKept   bool
+		want       types.DiagnosticSeverity
+	}{
+		{"matched by code", types.Diagnostic{Code: types.StringCode("E501"), Severity: types.DiagError}, true, types.DiagHint},
+		{"the code has to match as a whole", types.Diagnostic{Code: types.StringCode("E5011"), Severity: types.DiagError}, true, types.DiagError},
+		{"matched by message", types.Diagnostic{Message: "[ruff] TODO: later", Severity: types.DiagError}, true, types.DiagInformation},
+		{"the first rule that matches decides", types.Diagnostic{Code: types.StringCode("E501"), Message: "TODO", Severity: types.DiagError}, true, types.DiagHint},
+		{"suppressed", types.Diagnostic{Code: types.StringCode("E101")}, false, 0},
+		{"every matcher has to match", types.Diagnostic{Source: &ruff, Message: "note: see here", Severity: types.DiagWarning}, true, types.DiagWarning},
+		{"suppressed by source and message", types.Diagnostic{Source: &mypy, Message: "note: see here"}, false, 0},
+		{"matched by nothing", types.Diagnostic{Code: types.IntCode(7), Severity: types.DiagWarning}, true, types.DiagWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.diagnostic
+			require.Equal(t, tt.wantKept, rules.apply(&d))
+			if tt.wantKept {
+				assert.Equal(t, tt.want, d.Severity)
+			}
+		})
+	}
+}
+
+func TestBuildSeverityRulesRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		rule types.SeverityRule
+		want string
+	}{
+		{"a rule that does nothing", types.SeverityRule{Code: "E501"}, "severity has to be 1 to 4"},
+		{"a severity that is none", types.SeverityRule{Code: "E501", Severity: 5}, "severity has to be 1 to 4"},
+		{"a bad pattern", types.SeverityRule{Message: "(", Suppress: true}, "invalid message pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildSeverityRules([]types.SeverityRule{{Suppress: true}, tt.rule})
+			assert.ErrorContains(t, err, "lintSeverityRules[1]: "+tt.want)
+		})
+	}
+}
+
+func TestLintSeverityRules(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the lint command below is written as a POSIX shell command")
+	}
+
+	file := filepath.Join(t.TempDir(), "foo.py")
+	f := fileRef{NormalizedFilename: filepath.ToSlash(file), Uri: ParseLocalFileToURI(file), Text: "x = 1\ny = 2\n"}
+
+	diagnostics, err := lintDocument(t.Context(), nil, nil, filepath.Dir(file), f, types.Language{
+		LintCommand:        fmt.Sprintf("printf '%%s\\n' %q %q %q", "1:E501 line too long", "2:F401 unused import", "2:note: about F401"),
+		LintStdin:          true,
+		LintFormats:        []string{"%l:%tote: %m", "%l:%m"},
+		LintIgnoreExitCode: true,
+		LintCodePattern:    `^(\w+) `,
+		LintNotesAsRelated: true,
+		LintSeverityRules: []types.SeverityRule{
+			{Code: "E501", Severity: types.DiagHint},
+			{Code: "F401", Suppress: true},
+		},
+	}, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.Len(t, diagnostics, 1, "F401 is dropped, along with the note about it")
+	assert.Equal(t, types.StringCode("E501"), diagnostics[0].Code)
+	assert.Equal(t, types.DiagHint, diagnostics[0].Severity)
+	assert.Empty(t, diagnostics[0].RelatedInformation)
+}
@@ -2,9 +2,9 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"time"
@@ -43,10 +43,28 @@ const waitDelay = time.Second
 
 // buildExecCmd prepares a tool invocation. A nil stdin means the tool is not fed
 // the document, which is what a linter that reads the file itself wants.
-func buildExecCmd(ctx context.Context, command, dir string, env []string, stdin io.Reader) *exec.Cmd {
-	cmd := exec.CommandContext(ctx, shell, shellFlag, command)
+func buildExecCmd(ctx context.Context, command, dir string, config types.Language, stdin io.Reader) *exec.Cmd {
+	return prepareCmd(exec.CommandContext(ctx, shell, shellFlag, command), dir, config, stdin)
+}
+
+// errNoCommand reports a tool configured as a list of arguments that, once its
+// placeholders are filled in, has none left to run.
+var errNoCommand = errors.New("no command to run: every argument was left empty")
+
+// buildExecArgv is buildExecCmd for a tool configured as a list of arguments. It
+// runs without a shell, so each argument reaches the tool exactly as given.
+func buildExecArgv(ctx context.Context, argv []string, dir string, config types.Language, stdin io.Reader) (*exec.Cmd, error) {
+	if len(argv) == 0 {
+		return nil, errNoCommand
+	}
+	return prepareCmd(exec.CommandContext(ctx, argv[0], argv[1:]...), dir, config, stdin), nil
+}
+
+// prepareCmd sets up the process a tool runs as. The config's limits are not
+// among it: those need a running process, and are applied by startCmd.
+func prepareCmd(cmd *exec.Cmd, dir string, config types.Language, stdin io.Reader) *exec.Cmd {
 	cmd.Dir = dir
-	cmd.Env = append(os.Environ(), env...)
+	cmd.Env = append(inheritedEnv(config.EnvAllowlist), config.Env...)
 	cmd.Stdin = stdin
 	cmd.WaitDelay = waitDelay
 	makeCmdKillable(cmd)
@@ -54,13 +72,6 @@ func buildExecCmd(ctx context.Context, command, dir string, env []string, stdin
 	return cmd
 }
 
-func intPtrIfNotZero(n int) *int {
-	if n == 0 {
-		return nil
-	}
-	return &n
-}
-
 func boolOrDefault(b *bool, def bool) bool {
 	if b == nil {
 		return def
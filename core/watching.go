@@ -0,0 +1,120 @@
+package core
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/konradmalik/flint-ls/logs"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// LintWatchPatterns lists the lintWatchFiles globs of every config, each once
+// and in a stable order, for a client to watch. They are meant for a watcher
+// that knows nothing of the roots the globs are relative to, so each is made to
+// match in any directory: the handler tells the files that matter from the rest
+// once it hears about them.
+func (h *LangHandler) LintWatchPatterns() []string {
+	var patterns []string
+	for _, pattern := range h.lintWatchFiles() {
+		patterns = append(patterns, "**/"+strings.TrimPrefix(pattern, "/"))
+	}
+	slices.Sort(patterns)
+
+	return slices.Compact(patterns)
+}
+
+// WatchedFilesChanged takes in that the files at uris were created, changed or
+// deleted, and returns the open documents whose diagnostics that may have
+// changed: those with a linter whose root holds one of the files and whose
+// lintWatchFiles match it there.
+//
+// A tool daemon running under a root holding such a file is stopped when the
+// lintWatchFiles of a config it runs for match the file, since a tool reads its
+// configuration once and would go on using what it read. It starts again on the
+// next run.
+func (h *LangHandler) WatchedFilesChanged(uris []types.DocumentURI) []types.DocumentURI {
+	var changed []string
+	for _, uri := range uris {
+		fname, err := normalizedFilenameFromUri(uri)
+		if err != nil {
+			// a client may watch more than files on disk, and this is no place to
+			// complain about it
+			logs.Log.Logf(logs.Debug, "ignoring watched %v: %v", uri, err)
+			continue
+		}
+		changed = append(changed, fname)
+	}
+
+	var affected []types.DocumentURI
+	for _, doc := range h.OpenDocuments() {
+		snap, err := h.snapshot(doc.URI)
+		if err != nil {
+			// closed since it was listed
+			continue
+		}
+
+		configs := snap.resolveConfigs(
+			func(cfg types.Language) bool { return cfg.HasLinter() && len(cfg.LintWatchFiles) > 0 })
+		if slices.ContainsFunc(configs, func(cfg resolvedConfig) bool { return watchesAny(cfg.rootPath, cfg.LintWatchFiles, changed) }) {
+			affected = append(affected, doc.URI)
+		}
+	}
+
+	// daemons are judged by the configs they run for rather than by the open
+	// documents: one left running under a root with nothing open would otherwise
+	// serve the next document opened there with what it read before the change
+	h.daemons.stopWhere(func(key daemonKey) bool { return watchesAny(key.root, h.daemonWatchFiles(key), changed) })
+
+	return affected
+}
+
+// lintWatchFiles gathers the lintWatchFiles of every config with a linter.
+func (h *LangHandler) lintWatchFiles() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var patterns []string
+	for _, configs := range h.configs {
+		for _, cfg := range configs {
+			if cfg.HasLinter() {
+				patterns = append(patterns, cfg.LintWatchFiles...)
+			}
+		}
+	}
+
+	return patterns
+}
+
+// daemonWatchFiles gathers the lintWatchFiles of the configs whose linter or
+// formatter runs as the daemon key is for. Those are the files that daemon reads
+// its configuration from; a change to what another tool reads is no reason to
+// restart it.
+func (h *LangHandler) daemonWatchFiles(key daemonKey) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var patterns []string
+	for _, configs := range h.configs {
+		for _, cfg := range configs {
+			if (cfg.LintDaemon && daemonKeyFor(cfg.LintCommand, cfg.LintArgs, key.root) == key) ||
+				(cfg.FormatDaemon && daemonKeyFor(cfg.FormatCommand, cfg.FormatArgs, key.root) == key) {
+				patterns = append(patterns, cfg.LintWatchFiles...)
+			}
+		}
+	}
+
+	return patterns
+}
+
+// watchesAny reports whether one of the files is in root and matches one of the
+// patterns there.
+func watchesAny(root string, patterns, fnames []string) bool {
+	for _, fname := range fnames {
+		rel, ok := relativeTo(root, fname)
+		if ok && slices.ContainsFunc(patterns, func(pattern string) bool { return matchGlob(pattern, rel) }) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestLintWatchPatterns(t *testing.T) {
+	h := NewHandler(map[string][]types.Language{
+		"go":         {{LintCommand: "golangci-lint run", LintWatchFiles: []string{".golangci.yml", "/.golangci.yaml"}}},
+		"javascript": {{LintCommand: "eslint", LintWatchFiles: []string{".eslintrc*", "config/**"}}},
+		"typescript": {{LintCommand: "eslint", LintWatchFiles: []string{".eslintrc*"}}},
+		// nothing lints here, so nothing needs watching
+		"python": {{FormatCommand: "black -", LintWatchFiles: []string{"pyproject.toml"}}},
+	})
+
+	assert.Equal(t, []string{"**/.eslintrc*", "**/.golangci.yaml", "**/.golangci.yml", "**/config/**"}, h.LintWatchPatterns())
+}
+
+func TestWatchedFilesChanged(t *testing.T) {
+	// a/
+	//   go.mod
+	//   a.go
+	//   notes.txt
+	// b/
+	//   go.mod
+	//   b.go
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, root := range []string{a, b} {
+		require.NoError(t, os.MkdirAll(root, 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "go.mod"), nil, 0o600))
+	}
+
+	h := NewHandler(map[string][]types.Language{
+		"go": {{LintCommand: "true", RootMarkers: []string{"go.mod"}, LintWatchFiles: []string{".golangci.yml"}}},
+		// lints under the same root, but watches nothing
+		"text": {{LintCommand: "true", RootMarkers: []string{"go.mod"}}},
+	})
+	t.Cleanup(h.Close)
+
+	aGo := ParseLocalFileToURI(filepath.Join(a, "a.go"))
+	bGo := ParseLocalFileToURI(filepath.Join(b, "b.go"))
+	require.NoError(t, h.OpenFile(aGo, "go", 1, ""))
+	require.NoError(t, h.OpenFile(bGo, "go", 1, ""))
+	require.NoError(t, h.OpenFile(ParseLocalFileToURI(filepath.Join(a, "notes.txt")), "text", 1, ""))
+
+	tests := []struct {
+		name    string
+		changed []types.DocumentURI
+		want    []types.DocumentURI
+	}{
+		{"a watched file in the root", []types.DocumentURI{ParseLocalFileToURI(filepath.Join(a, ".golangci.yml"))}, []types.DocumentURI{aGo}},
+		{"a watched file deeper in the root", []types.DocumentURI{ParseLocalFileToURI(filepath.Join(b, "sub", ".golangci.yml"))}, []types.DocumentURI{bGo}},
+		{"a file nothing watches", []types.DocumentURI{ParseLocalFileToURI(filepath.Join(a, "README.md"))}, nil},
+		{"a watched file outside every root", []types.DocumentURI{ParseLocalFileToURI(filepath.Join(dir, ".golangci.yml"))}, nil},
+		{"something that is not a file", []types.DocumentURI{"untitled:Untitled-1"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.want, h.WatchedFilesChanged(tt.changed))
+		})
+	}
+}
+
+func TestWatchedFilesChangedStopsTheDaemonsUnderTheRoot(t *testing.T) {
+	command := daemonHelperCommand(t)
+	// another tool, as far as the pool can tell
+	other := command + " -test.count=1"
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	require.NoError(t, os.MkdirAll(a, 0o700))
+	require.NoError(t, os.MkdirAll(b, 0o700))
+
+	h := NewHandler(map[string][]types.Language{
+		"javascript": {{LintCommand: command, LintDaemon: true, LintWatchFiles: []string{".eslintrc*"}}},
+		"python":     {{FormatCommand: other, FormatDaemon: true, LintCommand: "ruff", LintWatchFiles: []string{"pyproject.toml"}}},
+	})
+	t.Cleanup(h.Close)
+
+	// none of the documents is open: a daemon is left running when they are closed
+	keyA := daemonKey{command: command, root: a}
+	keyB := daemonKey{command: command, root: b}
+	keyOther := daemonKey{command: other, root: a}
+	requestDaemon(t, h.daemons, keyA, "hello")
+	requestDaemon(t, h.daemons, keyB, "hello")
+	requestDaemon(t, h.daemons, keyOther, "hello")
+
+	h.WatchedFilesChanged([]types.DocumentURI{ParseLocalFileToURI(filepath.Join(a, "README.md"))})
+	assert.Len(t, h.daemons.daemons, 3, "a file nothing watches leaves the daemons be")
+
+	h.WatchedFilesChanged([]types.DocumentURI{ParseLocalFileToURI(filepath.Join(a, ".eslintrc.json"))})
+	assert.NotContains(t, h.daemons.daemons, keyA)
+	assert.Contains(t, h.daemons.daemons, keyB)
+	assert.Contains(t, h.daemons.daemons, keyOther, "a file another tool reads stopped this one")
+
+	h.WatchedFilesChanged([]types.DocumentURI{ParseLocalFileToURI(filepath.Join(a, "pyproject.toml"))})
+	assert.NotContains(t, h.daemons.daemons, keyOther)
+	assert.Contains(t, h.daemons.daemons, keyB)
+}
@@ -1,13 +1,19 @@
 package core
 
 import (
+	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf16"
 
 	"github.com/konradmalik/flint-ls/types"
 )
 
+// defaultSymbolPattern is what a symbol is made of when the config does not say:
+// an identifier, or a shell variable with its $.
+const defaultSymbolPattern = `[\pL\pN\pM_$]`
+
 // characters fall into one of these classes and a token is a run of characters
 // of a single class, which is how vim decides where a word ends too
 type charClass int
@@ -74,3 +80,123 @@ func classOf(r rune) charClass {
 		return classPunct
 	}
 }
+
+// rangeEndUtf16 is WordEndUtf16 for the other ways a range can end, as mode says.
+// symbol is the pattern a RangeModeSymbol symbol is a run of. Like
+// WordEndUtf16, it gives back pos.Character for a pos past the end of the line.
+func rangeEndUtf16(text string, pos types.Position, mode types.RangeMode, symbol string) int {
+	if mode == "" || mode == types.RangeModeWord {
+		return WordEndUtf16(text, pos)
+	}
+
+	line, ok := lineAt(text, pos.Line)
+	if !ok || pos.Character < 0 {
+		return pos.Character
+	}
+	rest, ok := fromUtf16(line, pos.Character)
+	if !ok {
+		return pos.Character
+	}
+
+	switch mode {
+	case types.RangeModeLine:
+		rest = strings.TrimRightFunc(rest, unicode.IsSpace)
+	case types.RangeModeUntilWhitespace:
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			rest = rest[:i]
+		}
+	case types.RangeModeSymbol:
+		re, err := symbolRegexp(symbol)
+		if err != nil {
+			return pos.Character
+		}
+		rest = rest[:len(re.FindString(rest))]
+	default:
+		rest = ""
+	}
+
+	return pos.Character + utf16Len(rest)
+}
+
+// virtualColumnUtf16 returns the character offset of the screen column vcol of
+// the line, both 0-based, with tabs every 8 columns: what errorformat's %v and %p
+// report is where the finding is on a terminal rather than in the text. A vcol
+// in the middle of a tab is the tab, and one past the end of the line is as many
+// characters past it.
+func virtualColumnUtf16(text string, line, vcol int) int {
+	l, ok := lineAt(text, line)
+	if !ok {
+		return vcol
+	}
+
+	offset, screen := 0, 0
+	for _, r := range l {
+		width := 1
+		if r == '\t' {
+			width = 8 - screen%8
+		}
+		if screen+width > vcol {
+			return offset
+		}
+		screen += width
+		offset += utf16.RuneLen(r)
+	}
+
+	return offset + vcol - screen
+}
+
+// lineAt returns the line with index n of text, without its line break.
+func lineAt(text string, n int) (string, bool) {
+	if n < 0 {
+		return "", false
+	}
+
+	for range n {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			return "", false
+		}
+		text = text[i+1:]
+	}
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+
+	return strings.TrimSuffix(text, "\r"), true
+}
+
+// fromUtf16 returns what of line follows the utf16 offset, and whether the offset
+// is in the line at all.
+func fromUtf16(line string, offset int) (string, bool) {
+	for i, r := range line {
+		if offset <= 0 {
+			return line[i:], true
+		}
+		offset -= utf16.RuneLen(r)
+	}
+
+	return "", offset == 0
+}
+
+// symbolRegexps holds the compiled symbol patterns, which are few and used for
+// every finding of their linter.
+var symbolRegexps sync.Map
+
+// symbolRegexp compiles pattern, one character of a symbol, into what matches a
+// symbol at the start of a text.
+func symbolRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = defaultSymbolPattern
+	}
+	if re, ok := symbolRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(`^(?:` + pattern + `)+`)
+	if err != nil {
+		return nil, err
+	}
+	symbolRegexps.Store(pattern, re)
+
+	return re, nil
+}
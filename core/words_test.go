@@ -89,3 +89,71 @@ func highlighted(text string, pos types.Position) string {
 	start := min(max(pos.Character, 0), len(chars))
 	return string(utf16.Decode(chars[start:min(max(end, start), len(chars))]))
 }
+
+func TestRangeEndUtf16(t *testing.T) {
+	text := "echo $HOME/bin  \nlocal x=😊y z\n"
+	tests := []struct {
+		name   string
+		mode   types.RangeMode
+		symbol string
+		pos    types.Position
+		// the text a client would highlight
+		expected string
+	}{
+		{"word is the default", "", "", types.Position{Line: 0, Character: 5}, "$"},
+		{"word", types.RangeModeWord, "", types.Position{Line: 0, Character: 6}, "HOME"},
+		{"line", types.RangeModeLine, "", types.Position{Line: 0, Character: 5}, "$HOME/bin"},
+		{"line from its start", types.RangeModeLine, "", types.Position{Line: 1, Character: 0}, "local x=😊y z"},
+		{"point", types.RangeModePoint, "", types.Position{Line: 0, Character: 5}, ""},
+		{"until whitespace", types.RangeModeUntilWhitespace, "", types.Position{Line: 0, Character: 5}, "$HOME/bin"},
+		{"until whitespace past an emoji", types.RangeModeUntilWhitespace, "", types.Position{Line: 1, Character: 6}, "x=😊y"},
+		{"symbol with the default pattern", types.RangeModeSymbol, "", types.Position{Line: 0, Character: 5}, "$HOME"},
+		{"symbol with a pattern of the config's", types.RangeModeSymbol, `[\w$/]`, types.Position{Line: 0, Character: 5}, "$HOME/bin"},
+		{"not a symbol", types.RangeModeSymbol, "", types.Position{Line: 1, Character: 7}, ""},
+		{"past the end of the line", types.RangeModeLine, "", types.Position{Line: 0, Character: 30}, ""},
+		{"past the last line", types.RangeModeLine, "", types.Position{Line: 5, Character: 0}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end := rangeEndUtf16(text, tt.pos, tt.mode, tt.symbol)
+			assert.Equal(t, tt.expected, textBetween(text, tt.pos, end))
+		})
+	}
+}
+
+func TestVirtualColumnUtf16(t *testing.T) {
+	text := "\tx = 1\nab\tc\n😊\td"
+	tests := []struct {
+		name     string
+		line     int
+		vcol     int
+		expected int
+	}{
+		{"the first column", 0, 0, 0},
+		{"in the middle of a tab", 0, 3, 0},
+		{"after a tab", 0, 8, 1},
+		{"after the tab", 0, 10, 3},
+		{"a tab that starts mid-stop", 1, 8, 3},
+		{"an emoji takes one column and two code units", 2, 8, 3},
+		{"past the end of the line", 1, 12, 7},
+		{"past the last line", 7, 4, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, virtualColumnUtf16(text, tt.line, tt.vcol))
+		})
+	}
+}
+
+// textBetween is the text of the line at pos from pos up to end.
+func textBetween(text string, pos types.Position, end int) string {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return ""
+	}
+	chars := utf16.Encode([]rune(lines[pos.Line]))
+	start := min(pos.Character, len(chars))
+	return string(utf16.Decode(chars[start:min(max(end, start), len(chars))]))
+}
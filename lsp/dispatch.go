@@ -10,12 +10,15 @@ import (
 // before it can answer, so running one on the read loop stalls the whole
 // connection until that tool exits.
 //
-// Only formatting qualifies. Linting shells out to external tools too, but it is
-// triggered by notifications whose handlers merely arm a timer and return, so
-// that work already happens off the read loop -- see ScheduleLinting.
+// Formatting qualifies, and so do commands, which run tools on demand. Linting
+// shells out to external tools too, but it is triggered by notifications whose
+// handlers merely arm a timer and return, so that work already happens off the
+// read loop -- see ScheduleLinting.
 var blockingRequests = map[string]bool{
-	"textDocument/formatting":      true,
-	"textDocument/rangeFormatting": true,
+	"textDocument/formatting":       true,
+	"textDocument/rangeFormatting":  true,
+	"textDocument/onTypeFormatting": true,
+	"workspace/executeCommand":      true,
 }
 
 // OffloadSlowRequests runs the requests that wait on external tools in their own
@@ -16,7 +16,17 @@ func (h *LspHandler) HandleInitialize(_ context.Context, _ *jsonrpc2.Conn, req *
 
 	h.mu.Lock()
 	h.progressSupported = params.Capabilities.Window.WorkDoneProgress
+	h.diagnosticSupport = params.Capabilities.TextDocument.PublishDiagnostics
+	h.watchingSupported = params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
 	h.mu.Unlock()
 
-	return h.langHandler.Initialize(params)
+	result, err := h.langHandler.Initialize(params)
+	if err != nil {
+		return result, err
+	}
+	// the commands are the server's own rather than the configuration's, so they
+	// are the same whatever is configured
+	result.Capabilities.ExecuteCommandProvider = &types.ExecuteCommandOptions{Commands: commandNames()}
+
+	return result, nil
 }
@@ -0,0 +1,21 @@
+package lsp
+
+import (
+	"context"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// HandleInitialized takes note that the client is ready for requests of the
+// server's own, and makes the first of them: watching the files the linters read
+// their configuration from.
+func (h *LspHandler) HandleInitialized(_ context.Context, conn *jsonrpc2.Conn, _ *jsonrpc2.Request) (any, error) {
+	h.mu.Lock()
+	h.initialized = true
+	h.mu.Unlock()
+
+	// waits on the client, which answers on the read loop this is running on
+	go h.UpdateFileWatchers(context.Background(), h.notifier(conn))
+
+	return nil, nil
+}
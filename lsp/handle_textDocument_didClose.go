@@ -8,7 +8,7 @@ import (
 	"github.com/konradmalik/flint-ls/types"
 )
 
-func (h *LspHandler) HandleTextDocumentDidClose(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+func (h *LspHandler) HandleTextDocumentDidClose(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
 	params, err := decodeParams[types.DidCloseTextDocumentParams](req)
 	if err != nil {
 		return nil, err
@@ -17,6 +17,9 @@ func (h *LspHandler) HandleTextDocumentDidClose(_ context.Context, _ *jsonrpc2.C
 	// drop scheduled work first: acting on a document that is no longer open
 	// would fail to find it anyway
 	h.ForgetDocument(params.TextDocument.URI)
+	// closing forgets what its linters reported about the other documents, but
+	// only clearing publishes those without it
+	h.langHandler.ClearDiagnostics(ctx, h.notifier(conn), params.TextDocument.URI)
 	h.langHandler.CloseFile(params.TextDocument.URI)
 
 	return nil, nil
@@ -25,3 +25,12 @@ func (h *LspHandler) HandleTextDocumentRangeFormatting(ctx context.Context, conn
 
 	return h.Formatting(ctx, h.notifier(conn), params.TextDocument.URI, &params.Range, params.Options)
 }
+
+func (h *LspHandler) HandleTextDocumentOnTypeFormatting(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	params, err := decodeParams[types.DocumentOnTypeFormattingParams](req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.OnTypeFormatting(ctx, h.notifier(conn), params.TextDocument.URI, params.Position, params.Ch, params.Options)
+}
@@ -8,13 +8,22 @@ import (
 	"github.com/konradmalik/flint-ls/types"
 )
 
-func (h *LspHandler) HandleWorkspaceDidChangeConfiguration(_ context.Context, _ *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+func (h *LspHandler) HandleWorkspaceDidChangeConfiguration(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
 	params, err := decodeParams[types.DidChangeConfigurationParams](req)
 	if err != nil {
 		return nil, err
 	}
 
 	h.UpdateConfiguration(&params.Settings)
+	// settings that leave the languages and the filtering alone change nothing
+	// about the diagnostics the open documents have
+	if params.Settings.ChangesDiagnostics() {
+		h.RelintOpenDocuments(ctx, h.notifier(conn))
+	}
+	if params.Settings.Languages != nil {
+		// waits on the client, which answers on the read loop this is running on
+		go h.UpdateFileWatchers(context.Background(), h.notifier(conn))
+	}
 
 	return nil, nil
 }
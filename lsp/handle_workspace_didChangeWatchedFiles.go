@@ -0,0 +1,110 @@
+package lsp
+
+import (
+	"context"
+	"slices"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/logs"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// watchedFilesRegistration identifies the one registration of file watchers the
+// server keeps with the client, so that it can be taken back when the globs
+// change.
+const watchedFilesRegistration = "flint-ls.lintWatchFiles"
+
+// watcherClient is what keeping the client's file watchers in line with the
+// configuration asks of the client.
+type watcherClient interface {
+	RegisterCapability(ctx context.Context, params types.RegistrationParams) error
+	UnregisterCapability(ctx context.Context, params types.UnregistrationParams) error
+}
+
+func (h *LspHandler) HandleWorkspaceDidChangeWatchedFiles(_ context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	params, err := decodeParams[types.DidChangeWatchedFilesParams](req)
+	if err != nil {
+		return nil, err
+	}
+
+	// stopping the daemons waits for them to exit, which is no business of the
+	// read loop
+	go h.WatchedFilesChanged(h.notifier(conn), params.Changes)
+
+	return nil, nil
+}
+
+// WatchedFilesChanged lints the open documents a change to the files affects
+// again. What their linters found before goes first: it was found under the old
+// configuration, and a linter the run does not include would otherwise keep it
+// up. The runs go through the usual debounce, so that a branch switch touching
+// several of them costs a single run per document.
+func (h *LspHandler) WatchedFilesChanged(reporter core.Reporter, changes []types.FileEvent) {
+	uris := make([]types.DocumentURI, 0, len(changes))
+	for _, change := range changes {
+		uris = append(uris, change.URI)
+	}
+
+	for _, uri := range h.langHandler.WatchedFilesChanged(uris) {
+		h.langHandler.ClearDiagnostics(context.Background(), reporter, uri)
+		h.ScheduleLinting(reporter, uri, configurationEvents)
+	}
+}
+
+// UpdateFileWatchers has the client watch the files the configuration's
+// lintWatchFiles name, in place of what it was asked to watch before. It does
+// nothing for a client that cannot be asked, or one that has not said it is
+// ready to be. Asking waits for the client's answer, so it must not be called on
+// the connection's read loop.
+func (h *LspHandler) UpdateFileWatchers(ctx context.Context, client watcherClient) {
+	h.mu.Lock()
+	ready := h.watchingSupported && h.initialized && !h.closed
+	h.mu.Unlock()
+	if !ready {
+		return
+	}
+
+	h.watchMu.Lock()
+	defer h.watchMu.Unlock()
+
+	// read under watchMu, so that of two updates racing each other the one to go
+	// last sees the newest configuration
+	patterns := h.langHandler.LintWatchPatterns()
+	if slices.Equal(patterns, h.watched) {
+		return
+	}
+
+	if len(h.watched) > 0 {
+		err := client.UnregisterCapability(ctx, types.UnregistrationParams{
+			Unregisterations: []types.Unregistration{{ID: watchedFilesRegistration, Method: "workspace/didChangeWatchedFiles"}},
+		})
+		if err != nil {
+			logs.Log.Logf(logs.Warn, "could not stop watching %v: %v", h.watched, err)
+			return
+		}
+		h.watched = nil
+	}
+
+	if len(patterns) > 0 {
+		watchers := make([]types.FileSystemWatcher, 0, len(patterns))
+		for _, pattern := range patterns {
+			watchers = append(watchers, types.FileSystemWatcher{GlobPattern: pattern})
+		}
+
+		err := client.RegisterCapability(ctx, types.RegistrationParams{
+			Registrations: []types.Registration{{
+				ID:              watchedFilesRegistration,
+				Method:          "workspace/didChangeWatchedFiles",
+				RegisterOptions: types.DidChangeWatchedFilesRegistrationOptions{Watchers: watchers},
+			}},
+		})
+		if err != nil {
+			logs.Log.Logf(logs.Warn, "could not watch %v: %v", patterns, err)
+			return
+		}
+	}
+
+	h.watched = patterns
+}
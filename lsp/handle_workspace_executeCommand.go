@@ -0,0 +1,203 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/types"
+)
+
+// command is a workspace/executeCommand command. It gets the arguments exactly
+// as the client sent them, since what they hold differs from one command to the
+// next.
+type command func(h *LspHandler, ctx context.Context, client commandClient, args []json.RawMessage) (any, error)
+
+// commandClient is what a command may ask of the client: everything a lint or
+// format run reports, and applying the edits a command computed.
+type commandClient interface {
+	core.Reporter
+	ApplyEdit(ctx context.Context, params types.ApplyWorkspaceEditParams) error
+}
+
+// commands are the commands the server announces in initialize, by name.
+var commands = map[string]command{
+	"flint-ls.clearDiagnostics": (*LspHandler).clearDiagnostics,
+	"flint-ls.doctor":           (*LspHandler).doctor,
+	"flint-ls.formatWith":       (*LspHandler).formatWith,
+	"flint-ls.lintAllOpen":      (*LspHandler).lintAllOpen,
+	"flint-ls.lintDocument":     (*LspHandler).lintDocument,
+	"flint-ls.restartTools":     (*LspHandler).restartTools,
+}
+
+// commandNames lists the commands, in a stable order for the client.
+func commandNames() []string {
+	return slices.Sorted(maps.Keys(commands))
+}
+
+func (h *LspHandler) HandleWorkspaceExecuteCommand(ctx context.Context, conn *jsonrpc2.Conn, req *jsonrpc2.Request) (any, error) {
+	params, err := decodeParams[types.ExecuteCommandParams](req)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.ExecuteCommand(ctx, h.notifier(conn), params)
+}
+
+// ExecuteCommand runs one of the commands the server announced.
+func (h *LspHandler) ExecuteCommand(ctx context.Context, client commandClient, params types.ExecuteCommandParams) (any, error) {
+	run, ok := commands[params.Command]
+	if !ok {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("unknown command: %s", params.Command)}
+	}
+
+	return run(h, ctx, client, params.Arguments)
+}
+
+// commandArgument decodes the i-th argument of a command into T. A missing
+// optional argument leaves T at its zero value.
+func commandArgument[T any](args []json.RawMessage, i int, required bool) (T, error) {
+	var arg T
+
+	if i >= len(args) {
+		if required {
+			return arg, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("missing argument %d", i+1)}
+		}
+		return arg, nil
+	}
+	if err := json.Unmarshal(args[i], &arg); err != nil {
+		return arg, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("argument %d: %v", i+1, err)}
+	}
+
+	return arg, nil
+}
+
+// doctorResult is the diagnosis as data, along with the text `flint-ls doctor`
+// prints for it, which is what a client without a way to show the data shows.
+type doctorResult struct {
+	core.Diagnosis
+	Report string `json:"report"`
+}
+
+// doctor is flint-ls.doctor: it explains an open document, given as its URI,
+// the way `flint-ls doctor` explains a file. The formatting options a formatter's
+// dry run gets may follow the URI.
+func (h *LspHandler) doctor(ctx context.Context, _ commandClient, args []json.RawMessage) (any, error) {
+	uri, err := commandArgument[types.DocumentURI](args, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	options, err := commandArgument[types.FormattingOptions](args, 1, false)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnosis, err := h.langHandler.Diagnose(ctx, uri, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return doctorResult{Diagnosis: diagnosis, Report: diagnosis.Report()}, nil
+}
+
+// lintDocument is flint-ls.lintDocument: it lints an open document, given as its
+// URI, with every linter that applies to it, including those set to run on no
+// event at all. Like any other run it is scheduled, so the command returns before
+// the linters are done and their diagnostics are published as usual.
+func (h *LspHandler) lintDocument(_ context.Context, client commandClient, args []json.RawMessage) (any, error) {
+	uri, err := commandArgument[types.DocumentURI](args, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	if !h.isOpen(uri) {
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("document not open: %v", uri)}
+	}
+
+	h.ScheduleLinting(client, uri, types.EventTypeCommand)
+
+	return nil, nil
+}
+
+// lintAllOpen is flint-ls.lintAllOpen: lintDocument for every open document.
+func (h *LspHandler) lintAllOpen(_ context.Context, client commandClient, _ []json.RawMessage) (any, error) {
+	for _, doc := range h.langHandler.OpenDocuments() {
+		h.ScheduleLinting(client, doc.URI, types.EventTypeCommand)
+	}
+
+	return nil, nil
+}
+
+// clearDiagnostics is flint-ls.clearDiagnostics: it takes the diagnostics of the
+// document given as its URI off the client, or those of every open document when
+// there is no URI. The next edit or save lints as usual.
+func (h *LspHandler) clearDiagnostics(ctx context.Context, client commandClient, args []json.RawMessage) (any, error) {
+	uri, err := commandArgument[types.DocumentURI](args, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range h.langHandler.OpenDocuments() {
+		if uri != "" && doc.URI != uri {
+			continue
+		}
+		h.clearDocument(ctx, client, doc)
+	}
+
+	return nil, nil
+}
+
+// restartTools is flint-ls.restartTools: it stops the tool daemons, which start
+// again when they are next needed, and lints every open document again. A run
+// that was waiting on a daemon fails when it stops, and the documents should not
+// be left with what such a run did not get to publish.
+func (h *LspHandler) restartTools(ctx context.Context, client commandClient, args []json.RawMessage) (any, error) {
+	h.langHandler.RestartTools()
+
+	return h.lintAllOpen(ctx, client, args)
+}
+
+// formatWith is flint-ls.formatWith: it formats an open document, given as its
+// URI, with the one formatter named next -- its command as configured, or the
+// program that runs -- and has the client apply the result. Formatting options
+// may follow the name. It competes with the other formatting requests for the
+// document, as its edits are a diff against the same text theirs are.
+func (h *LspHandler) formatWith(ctx context.Context, client commandClient, args []json.RawMessage) (any, error) {
+	uri, err := commandArgument[types.DocumentURI](args, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	name, err := commandArgument[string](args, 1, true)
+	if err != nil {
+		return nil, err
+	}
+	options, err := commandArgument[types.FormattingOptions](args, 2, false)
+	if err != nil {
+		return nil, err
+	}
+
+	edits, err := h.formatting(uri, func() ([]types.TextEdit, error) {
+		return h.langHandler.RunFormatter(ctx, client, uri, nil, options, name)
+	})
+	if err != nil || len(edits) == 0 {
+		return nil, err
+	}
+
+	// the client is asked rather than answered: a command's result is not
+	// something any client applies
+	return nil, client.ApplyEdit(ctx, types.ApplyWorkspaceEditParams{
+		Label: "Format with " + name,
+		Edit:  types.WorkspaceEdit{Changes: map[types.DocumentURI][]types.TextEdit{uri: edits}},
+	})
+}
+
+// isOpen reports whether uri is an open document.
+func (h *LspHandler) isOpen(uri types.DocumentURI) bool {
+	return slices.ContainsFunc(h.langHandler.OpenDocuments(), func(doc types.VersionedTextDocumentIdentifier) bool {
+		return doc.URI == uri
+	})
+}
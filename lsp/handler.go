@@ -42,9 +42,21 @@ type LspHandler struct {
 	// progressSupported is what the client said about work-done progress in
 	// initialize. Until then nothing is reported, which is the safe assumption.
 	progressSupported bool
+	// diagnosticSupport is what it said about the optional parts of diagnostics,
+	// none of which is sent until then
+	diagnosticSupport types.PublishDiagnosticsClientCapabilities
+	// watchingSupported is what the client said in initialize about being asked
+	// to watch files, and initialized that it is ready to be asked
+	watchingSupported bool
+	initialized       bool
 	shutdownRequested bool
 	exitRequested     bool
 	closed            bool
+
+	// watchMu serializes the registrations of file watchers, which wait on the
+	// client, and guards watched: the globs the client was last asked to watch
+	watchMu sync.Mutex
+	watched []string
 }
 
 // notifier builds the channel back to the client for one piece of work.
@@ -52,7 +64,7 @@ func (h *LspHandler) notifier(conn *jsonrpc2.Conn) *LspNotifier {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	return NewNotifier(conn, h.progressSupported)
+	return NewNotifier(conn, h.progressSupported, h.diagnosticSupport)
 }
 
 // lintJob is one scheduled lint run of a single document: a debounce interval
@@ -118,7 +130,7 @@ func (h *LspHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 	case "initialize":
 		return h.HandleInitialize(ctx, conn, req)
 	case "initialized":
-		return nil, nil
+		return h.HandleInitialized(ctx, conn, req)
 	case "shutdown":
 		return h.HandleShutdown(ctx, conn, req)
 	case "textDocument/didOpen":
@@ -133,8 +145,14 @@ func (h *LspHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 		return h.HandleTextDocumentFormatting(ctx, conn, req)
 	case "textDocument/rangeFormatting":
 		return h.HandleTextDocumentRangeFormatting(ctx, conn, req)
+	case "textDocument/onTypeFormatting":
+		return h.HandleTextDocumentOnTypeFormatting(ctx, conn, req)
 	case "workspace/didChangeConfiguration":
 		return h.HandleWorkspaceDidChangeConfiguration(ctx, conn, req)
+	case "workspace/didChangeWatchedFiles":
+		return h.HandleWorkspaceDidChangeWatchedFiles(ctx, conn, req)
+	case "workspace/executeCommand":
+		return h.HandleWorkspaceExecuteCommand(ctx, conn, req)
 	}
 
 	return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: fmt.Sprintf("method not supported: %s", req.Method)}
@@ -150,9 +168,26 @@ func (h *LspHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, req *jsonr
 // Saying so with an error keeps the client honest -- answering with an empty edit
 // list would instead claim the document needs no changes.
 func (h *LspHandler) Formatting(ctx context.Context, reporter core.Reporter, uri types.DocumentURI, rng *types.Range, opt types.FormattingOptions) ([]types.TextEdit, error) {
+	return h.formatting(uri, func() ([]types.TextEdit, error) {
+		return h.langHandler.RunAllFormatters(ctx, reporter, uri, rng, opt)
+	})
+}
+
+// OnTypeFormatting formats the lines around pos after the user typed ch. It
+// competes with the other formatting requests for the same document, because its
+// edits are a diff against the same text theirs are.
+func (h *LspHandler) OnTypeFormatting(ctx context.Context, reporter core.Reporter, uri types.DocumentURI, pos types.Position, ch string, opt types.FormattingOptions) ([]types.TextEdit, error) {
+	return h.formatting(uri, func() ([]types.TextEdit, error) {
+		return h.langHandler.RunOnTypeFormatters(ctx, reporter, uri, pos, ch, opt)
+	})
+}
+
+// formatting runs one formatting request for uri, answering for it only if no
+// newer request has arrived for the document in the meantime.
+func (h *LspHandler) formatting(uri types.DocumentURI, run func() ([]types.TextEdit, error)) ([]types.TextEdit, error) {
 	req := h.claimFormatting(uri)
 
-	edits, err := h.langHandler.RunAllFormatters(ctx, reporter, uri, rng, opt)
+	edits, err := run()
 
 	// asked after the run rather than before it, because a request that has
 	// already started is precisely the one whose edits would otherwise reach the
@@ -266,10 +301,54 @@ func (h *LspHandler) ScheduleLinting(reporter core.Reporter, uri types.DocumentU
 	}()
 }
 
+// configurationEvents are the events a run after a configuration change covers:
+// every document event, since the diagnostics from each of them may have changed.
+// Not EventTypeCommand, as a linter kept for when it is asked for was not.
+const configurationEvents = types.EventTypeOpen | types.EventTypeChange | types.EventTypeSave
+
+// RelintOpenDocuments brings the diagnostics of every open document in line with
+// a configuration that has just changed. A document with a linter is linted
+// again, through the usual debounce, so that a client sending its settings in a
+// burst of notifications costs a single run per document. A document left with
+// none has its diagnostics cleared, as no run is ever going to replace them.
+func (h *LspHandler) RelintOpenDocuments(ctx context.Context, reporter core.Reporter) {
+	for _, doc := range h.langHandler.OpenDocuments() {
+		if h.langHandler.HasLinters(doc.URI, configurationEvents) {
+			h.ScheduleLinting(reporter, doc.URI, configurationEvents)
+		} else {
+			h.clearDocument(ctx, reporter, doc)
+		}
+	}
+}
+
+// clearDocument takes the diagnostics of doc off the client, dropping the run
+// scheduled for it, which would only publish them again, and what the linters
+// found before, which the next run would.
+func (h *LspHandler) clearDocument(ctx context.Context, reporter core.Reporter, doc types.VersionedTextDocumentIdentifier) {
+	h.cancelLinting(doc.URI)
+	h.langHandler.ClearDiagnostics(ctx, reporter, doc.URI)
+	reporter.PublishDiagnostics(ctx, types.PublishDiagnosticsParams{
+		URI:         doc.URI,
+		Diagnostics: make([]types.Diagnostic, 0),
+		Version:     doc.Version,
+	})
+}
+
 // ForgetDocument drops everything scheduled for uri. Used when a document is
 // closed: its diagnostics are no longer wanted, and a formatting run still going
 // for it can no longer produce anything useful.
 func (h *LspHandler) ForgetDocument(uri types.DocumentURI) {
+	h.cancelLinting(uri)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a run still formatting this document finds its entry gone and gives up
+	delete(h.formats, uri)
+}
+
+// cancelLinting drops the lint run scheduled for uri, if there is one.
+func (h *LspHandler) cancelLinting(uri types.DocumentURI) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -277,8 +356,6 @@ func (h *LspHandler) ForgetDocument(uri types.DocumentURI) {
 		job.cancel()
 		delete(h.lints, uri)
 	}
-	// a run still formatting this document finds its entry gone and gives up
-	delete(h.formats, uri)
 }
 
 // finishLinting releases the run's context and forgets the document unless a
@@ -313,10 +390,14 @@ func (h *LspHandler) ExitCode() int {
 	return 0
 }
 
-// Close abandons all scheduled work and refuses to schedule more. It does not
-// wait for in-flight linters: their contexts are cancelled, which kills the
-// external processes, and their results are discarded.
+// Close abandons all scheduled work, stops the tool daemons and refuses to
+// schedule more. It does not wait for in-flight linters: their contexts are
+// cancelled, which kills the external processes, and their results are discarded.
 func (h *LspHandler) Close() {
+	// nothing is going to ask the daemons for anything anymore. Stopping them
+	// waits for the processes to go, which is not something to do under mu
+	h.langHandler.Close()
+
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -198,6 +198,167 @@ func TestLintRunOfAReopenedDocumentSurvivesTheOldOne(t *testing.T) {
 	assert.Same(t, fresh, h.currentLintJob(t, uri))
 }
 
+func TestRelintOpenDocumentsAfterAConfigurationChange(t *testing.T) {
+	h := newTestHandler(t, time.Millisecond)
+	reporter := &fakeReporter{}
+	uri := newTestDocument(t, h, "a.txt")
+
+	h.UpdateConfiguration(&types.Config{Languages: map[string][]types.Language{testLanguageID: {{
+		LintCommand:        "echo 1:from the new config",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+	}}}})
+	h.RelintOpenDocuments(t.Context(), reporter)
+
+	require.Eventually(t, func() bool {
+		return len(reporter.diagnosticsFor(uri)) == 1
+	}, 5*time.Second, time.Millisecond, "the document was not linted with the new config")
+	assert.Equal(t, "from the new config", reporter.diagnosticsFor(uri)[0].Message)
+}
+
+func TestRelintOpenDocumentsClearsThoseLeftWithoutALinter(t *testing.T) {
+	h := newTestHandler(t, neverFires)
+	reporter := &fakeReporter{}
+	uri := newTestDocument(t, h, "a.txt")
+	h.ScheduleLinting(reporter, uri, types.EventTypeChange)
+
+	h.UpdateConfiguration(&types.Config{Languages: map[string][]types.Language{
+		testLanguageID: {{FormatCommand: appendingFormatCommand()}},
+	}})
+	h.RelintOpenDocuments(t.Context(), reporter)
+
+	assert.Equal(t, []types.DocumentURI{uri}, reporter.resetDocuments(),
+		"no run is ever going to replace the diagnostics of a linter that is gone")
+	assert.Empty(t, h.pendingLints(), "a run of the old linters would publish them again")
+}
+
+func TestRelintOpenDocumentsClearsExcludedOnes(t *testing.T) {
+	h := newTestHandler(t, neverFires)
+	reporter := &fakeReporter{}
+	excluded := newTestDocument(t, h, "generated.txt")
+	linted := newTestDocument(t, h, "a.txt")
+
+	settings := types.Config{LintExclude: []string{"generated.*"}}
+	require.True(t, settings.ChangesDiagnostics())
+	h.UpdateConfiguration(&settings)
+	h.RelintOpenDocuments(t.Context(), reporter)
+
+	assert.Equal(t, []types.DocumentURI{excluded}, reporter.resetDocuments())
+	assert.Equal(t, []types.DocumentURI{linted}, slices.Collect(maps.Keys(h.pendingLints())))
+}
+
+func TestUpdateFileWatchers(t *testing.T) {
+	h := newTestHandlerWithLanguage(t, neverFires, types.Language{LintCommand: "true", LintWatchFiles: []string{".lintrc"}})
+	client := &fakeReporter{}
+
+	initializeWatching(t, h, true)
+	h.UpdateFileWatchers(t.Context(), client)
+	assert.Equal(t, [][]string{{"**/.lintrc"}}, client.registeredWatchers())
+
+	h.UpdateFileWatchers(t.Context(), client)
+	assert.Len(t, client.registeredWatchers(), 1, "the client is already watching the same files")
+
+	h.UpdateConfiguration(&types.Config{Languages: map[string][]types.Language{
+		testLanguageID: {{LintCommand: "true", LintWatchFiles: []string{"lint.toml"}}},
+	}})
+	h.UpdateFileWatchers(t.Context(), client)
+	assert.Equal(t, [][]string{{"**/.lintrc"}, nil, {"**/lint.toml"}}, client.registeredWatchers(),
+		"the old watchers are taken back before the new ones are registered")
+
+	h.UpdateConfiguration(&types.Config{Languages: map[string][]types.Language{testLanguageID: {{LintCommand: "true"}}}})
+	h.UpdateFileWatchers(t.Context(), client)
+	assert.Equal(t, [][]string{{"**/.lintrc"}, nil, {"**/lint.toml"}, nil}, client.registeredWatchers(),
+		"with nothing to watch, nothing is registered")
+}
+
+func TestUpdateFileWatchersOnlyAsksAClientThatIsReady(t *testing.T) {
+	language := types.Language{LintCommand: "true", LintWatchFiles: []string{".lintrc"}}
+
+	t.Run("before initialized", func(t *testing.T) {
+		h := newTestHandlerWithLanguage(t, neverFires, language)
+		client := &fakeReporter{}
+
+		h.UpdateFileWatchers(t.Context(), client)
+		assert.Empty(t, client.registeredWatchers())
+	})
+
+	t.Run("a client that cannot register watchers", func(t *testing.T) {
+		h := newTestHandlerWithLanguage(t, neverFires, language)
+		client := &fakeReporter{}
+
+		initializeWatching(t, h, false)
+		h.UpdateFileWatchers(t.Context(), client)
+		assert.Empty(t, client.registeredWatchers())
+	})
+}
+
+func TestWatchedFilesChangedLintsTheDocumentsUnderTheRoot(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.toml"), nil, 0o600))
+
+	h := newTestHandlerWithLanguage(t, time.Millisecond, types.Language{
+		LintCommand:        "echo 1:problem",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+		RootMarkers:        []string{"root.toml"},
+		LintWatchFiles:     []string{".lintrc"},
+	})
+	reporter := &fakeReporter{}
+	uri := core.ParseLocalFileToURI(filepath.Join(dir, "a.txt"))
+	require.NoError(t, h.langHandler.OpenFile(uri, testLanguageID, 1, "some text\n"))
+
+	h.WatchedFilesChanged(reporter, []types.FileEvent{{URI: core.ParseLocalFileToURI(filepath.Join(dir, "README.md")), Type: types.FileChanged}})
+	assert.Empty(t, h.pendingLints(), "nothing watches that file")
+
+	h.WatchedFilesChanged(reporter, []types.FileEvent{{URI: core.ParseLocalFileToURI(filepath.Join(dir, ".lintrc")), Type: types.FileCreated}})
+	require.Eventually(t, func() bool {
+		return len(reporter.diagnosticsFor(uri)) == 1
+	}, 5*time.Second, time.Millisecond, "the document was not linted again")
+}
+
+func TestWatchedFilesChangedDropsWhatTheLintersFoundBefore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.toml"), nil, 0o600))
+
+	off := false
+	watching := types.Language{
+		LintCommand:        "echo 1:problem",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+		RootMarkers:        []string{"root.toml"},
+		LintWatchFiles:     []string{".lintrc"},
+	}
+	// only run when asked for, so no run after the change replaces what it found
+	manual := types.Language{
+		LintCommand:        "echo 1:manual",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+		LintAfterOpen:      &off,
+		LintOnChange:       &off,
+		LintOnSave:         &off,
+	}
+	h := newTestHandlerWithLanguage(t, time.Millisecond, watching)
+	h.langHandler.UpdateConfiguration(&types.Config{Languages: map[string][]types.Language{testLanguageID: {watching, manual}}})
+	reporter := &fakeReporter{}
+	uri := core.ParseLocalFileToURI(filepath.Join(dir, "a.txt"))
+	require.NoError(t, h.langHandler.OpenFile(uri, testLanguageID, 1, "some text\n"))
+
+	require.NoError(t, h.langHandler.RunAllLinters(t.Context(), reporter, uri, types.EventTypeCommand))
+
+	reporter = &fakeReporter{}
+	h.WatchedFilesChanged(reporter, []types.FileEvent{{URI: core.ParseLocalFileToURI(filepath.Join(dir, ".lintrc")), Type: types.FileChanged}})
+	require.Eventually(t, func() bool {
+		return len(reporter.diagnosticsFor(uri)) > 0
+	}, 5*time.Second, time.Millisecond, "the document was not linted again")
+	d := reporter.diagnosticsFor(uri)
+	require.Len(t, d, 1, "what was found under the old configuration is still up")
+	assert.Equal(t, "problem", d[0].Message)
+}
+
 func TestForgetDocumentDropsScheduledRun(t *testing.T) {
 	h := newTestHandler(t, 10*time.Millisecond)
 	reporter := &fakeReporter{}
@@ -550,6 +711,48 @@ func TestProgressBeforeInitializeIsNotReported(t *testing.T) {
 		"nothing is known about the client yet, so nothing may be assumed")
 }
 
+func TestSupportedDiagnostics(t *testing.T) {
+	code := types.StringCode("F401")
+	full := types.Diagnostic{
+		Message:         "unused import",
+		Code:            code,
+		CodeDescription: &types.CodeDescription{Href: "https://example.com/rules/401"},
+		Tags:            []types.DiagnosticTag{types.DiagUnnecessary, types.DiagDeprecated},
+		RelatedInformation: []types.DiagnosticRelatedInformation{
+			{Location: types.Location{URI: "file:///other.h"}, Message: "declared here"},
+		},
+		Data: types.LintData{Output: []string{"a.c:1: 401 unused import"}},
+	}
+
+	tests := []struct {
+		name   string
+		params string
+		want   types.Diagnostic
+	}{
+		{"a client that takes everything", `{"capabilities":{"textDocument":{"publishDiagnostics":{
+			"relatedInformation":true,"codeDescriptionSupport":true,"dataSupport":true,"tagSupport":{"valueSet":[1,2]}}}}}`, full},
+		{"a client that takes nothing optional", `{"capabilities":{}}`, types.Diagnostic{Message: "unused import", Code: code}},
+		{"a client that takes some tags", `{"capabilities":{"textDocument":{"publishDiagnostics":{"tagSupport":{"valueSet":[2]}}}}}`,
+			types.Diagnostic{Message: "unused import", Code: code, Tags: []types.DiagnosticTag{types.DiagDeprecated}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, neverFires)
+			raw := json.RawMessage(tt.params)
+
+			_, err := h.HandleInitialize(t.Context(), nil, &jsonrpc2.Request{Method: "initialize", Params: &raw})
+			require.NoError(t, err)
+
+			diagnostics := []types.Diagnostic{full}
+			got := supportedDiagnostics(diagnostics, h.notifier(nil).diagnostics)
+
+			assert.Equal(t, []types.Diagnostic{tt.want}, got)
+			assert.Equal(t, full, diagnostics[0], "what the server keeps is left as it was")
+		})
+	}
+}
+
 func TestDecodeParams(t *testing.T) {
 	t.Run("decodes params", func(t *testing.T) {
 		raw := json.RawMessage(`{"textDocument":{"uri":"file:///a.txt"}}`)
@@ -577,6 +780,180 @@ func TestDecodeParams(t *testing.T) {
 	})
 }
 
+func TestInitializeAnnouncesCommands(t *testing.T) {
+	h := newTestHandler(t, neverFires)
+	raw := json.RawMessage(`{"capabilities":{}}`)
+
+	result, err := h.HandleInitialize(t.Context(), nil, &jsonrpc2.Request{Method: "initialize", Params: &raw})
+	require.NoError(t, err)
+
+	require.NotNil(t, result.Capabilities.ExecuteCommandProvider)
+	assert.Equal(t, commandNames(), result.Capabilities.ExecuteCommandProvider.Commands)
+	assert.Contains(t, result.Capabilities.ExecuteCommandProvider.Commands, "flint-ls.doctor")
+}
+
+func TestExecuteCommandDoctor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test linter is a POSIX shell command")
+	}
+
+	h := newTestHandler(t, neverFires)
+	uri := newTestDocument(t, h, "a.txt")
+
+	result, err := h.ExecuteCommand(t.Context(), &fakeReporter{}, types.ExecuteCommandParams{
+		Command:   "flint-ls.doctor",
+		Arguments: []json.RawMessage{commandArgumentJSON(t, uri)},
+	})
+	require.NoError(t, err)
+
+	doctor, ok := result.(doctorResult)
+	require.True(t, ok, "unexpected result %T", result)
+	require.Len(t, doctor.Configs, 1)
+	require.NotNil(t, doctor.Configs[0].Linter)
+	assert.Len(t, doctor.Configs[0].Linter.Diagnostics, 1)
+	assert.Contains(t, doctor.Report, "problem", "a client that cannot show the data still gets the text")
+}
+
+func TestExecuteCommandLintDocument(t *testing.T) {
+	off := false
+	h := newTestHandlerWithLanguage(t, time.Millisecond, types.Language{
+		LintCommand:        "echo 1:on demand",
+		LintFormats:        []string{"%l:%m"},
+		LintStdin:          true,
+		LintIgnoreExitCode: true,
+		LintAfterOpen:      &off,
+		LintOnChange:       &off,
+		LintOnSave:         &off,
+	})
+	reporter := &fakeReporter{}
+	uri := newTestDocument(t, h, "a.txt")
+	other := newTestDocument(t, h, "b.txt")
+
+	_, err := h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{
+		Command:   "flint-ls.lintDocument",
+		Arguments: []json.RawMessage{commandArgumentJSON(t, uri)},
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(reporter.diagnosticsFor(uri)) == 1
+	}, 5*time.Second, time.Millisecond, "a linter set to run on no event still runs when asked to")
+	assert.Empty(t, reporter.diagnosticsFor(other), "only the document asked for is linted")
+
+	_, err = h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{
+		Command:   "flint-ls.lintDocument",
+		Arguments: []json.RawMessage{commandArgumentJSON(t, "file:///not/open.txt")},
+	})
+	assert.Error(t, err)
+}
+
+func TestExecuteCommandLintAllOpen(t *testing.T) {
+	h := newTestHandler(t, time.Millisecond)
+	reporter := &fakeReporter{}
+	a := newTestDocument(t, h, "a.txt")
+	b := newTestDocument(t, h, "b.txt")
+
+	_, err := h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{Command: "flint-ls.lintAllOpen"})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(reporter.diagnosticsFor(a)) == 1 && len(reporter.diagnosticsFor(b)) == 1
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestExecuteCommandClearDiagnostics(t *testing.T) {
+	h := newTestHandler(t, neverFires)
+	reporter := &fakeReporter{}
+	a := newTestDocument(t, h, "a.txt")
+	b := newTestDocument(t, h, "b.txt")
+	h.ScheduleLinting(reporter, a, types.EventTypeChange)
+	h.ScheduleLinting(reporter, b, types.EventTypeChange)
+
+	_, err := h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{
+		Command:   "flint-ls.clearDiagnostics",
+		Arguments: []json.RawMessage{commandArgumentJSON(t, a)},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.DocumentURI{a}, reporter.resetDocuments())
+	assert.NotContains(t, h.pendingLints(), a, "a run still to come would publish them again")
+	assert.Contains(t, h.pendingLints(), b, "another document's run is none of the command's business")
+
+	_, err = h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{Command: "flint-ls.clearDiagnostics"})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []types.DocumentURI{a, a, b}, reporter.resetDocuments(), "without a document, every open one is cleared")
+	assert.Empty(t, h.pendingLints())
+}
+
+func TestExecuteCommandRestartToolsLintsAgain(t *testing.T) {
+	h := newTestHandler(t, time.Millisecond)
+	reporter := &fakeReporter{}
+	uri := newTestDocument(t, h, "a.txt")
+
+	_, err := h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{Command: "flint-ls.restartTools"})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(reporter.diagnosticsFor(uri)) == 1
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestExecuteCommandFormatWith(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the formatters below are POSIX tools")
+	}
+
+	langHandler := core.NewHandler(map[string][]types.Language{testLanguageID: {
+		{FormatCommand: appendingFormatCommand()},
+		{FormatArgs: []string{"tr", "a-z", "A-Z"}},
+	}})
+	h := NewHandler(langHandler)
+	t.Cleanup(h.Close)
+	reporter := &fakeReporter{}
+	uri := newTestDocument(t, h, "a.txt")
+
+	_, err := h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{
+		Command:   "flint-ls.formatWith",
+		Arguments: []json.RawMessage{commandArgumentJSON(t, uri), commandArgumentJSON(t, "tr")},
+	})
+	require.NoError(t, err)
+
+	applied := reporter.appliedEdits()
+	require.Len(t, applied, 1)
+	edits := applied[0].Edit.Changes[uri]
+	require.Len(t, edits, 1)
+	assert.Equal(t, "SOME TEXT\n", edits[0].NewText, "only the formatter named runs")
+	assert.Empty(t, h.pendingFormats())
+
+	_, err = h.ExecuteCommand(t.Context(), reporter, types.ExecuteCommandParams{
+		Command:   "flint-ls.formatWith",
+		Arguments: []json.RawMessage{commandArgumentJSON(t, uri), commandArgumentJSON(t, "prettier")},
+	})
+	assert.Error(t, err)
+	assert.Len(t, reporter.appliedEdits(), 1)
+}
+
+func TestExecuteCommandRejectsWhatItCannotRun(t *testing.T) {
+	h := newTestHandler(t, neverFires)
+
+	tests := map[string]types.ExecuteCommandParams{
+		"unknown command":    {Command: "flint-ls.nope"},
+		"missing argument":   {Command: "flint-ls.doctor"},
+		"malformed argument": {Command: "flint-ls.doctor", Arguments: []json.RawMessage{json.RawMessage(`42`)}},
+	}
+
+	for name, params := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := h.ExecuteCommand(t.Context(), &fakeReporter{}, params)
+
+			var rpcErr *jsonrpc2.Error
+			require.ErrorAs(t, err, &rpcErr)
+			assert.EqualValues(t, jsonrpc2.CodeInvalidParams, rpcErr.Code)
+		})
+	}
+}
+
 func TestOffloadSlowRequests(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -594,6 +971,16 @@ func TestOffloadSlowRequests(t *testing.T) {
 			req:         jsonrpc2.Request{Method: "textDocument/rangeFormatting"},
 			description: "formatting waits on an external tool and must not block the read loop",
 		},
+		{
+			name:        "on-type formatting is offloaded",
+			req:         jsonrpc2.Request{Method: "textDocument/onTypeFormatting"},
+			description: "formatting waits on an external tool and must not block the read loop",
+		},
+		{
+			name:        "commands are offloaded",
+			req:         jsonrpc2.Request{Method: "workspace/executeCommand"},
+			description: "commands run tools on demand and must not block the read loop",
+		},
 		{
 			name:        "document sync stays inline",
 			req:         jsonrpc2.Request{Method: "textDocument/didChange", Notif: true},
@@ -733,6 +1120,32 @@ func newTestDocument(t *testing.T, h *LspHandler, name string) types.DocumentURI
 	return uri
 }
 
+// initializeWatching takes h through initialize, with a client that says whether
+// it can be asked to watch files, and initialized.
+func initializeWatching(t *testing.T, h *LspHandler, supported bool) {
+	t.Helper()
+
+	raw := json.RawMessage(fmt.Sprintf(`{"capabilities":{"workspace":{"didChangeWatchedFiles":{"dynamicRegistration":%t}}}}`, supported))
+	_, err := h.HandleInitialize(t.Context(), nil, &jsonrpc2.Request{Method: "initialize", Params: &raw})
+	require.NoError(t, err)
+
+	// what HandleInitialized does, without registering with a client that is not
+	// there
+	h.mu.Lock()
+	h.initialized = true
+	h.mu.Unlock()
+}
+
+// commandArgumentJSON encodes v as a command argument.
+func commandArgumentJSON(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+
+	raw, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	return raw
+}
+
 // newTestConn returns a live connection whose peer never answers. It is enough
 // for handlers that only need something to close.
 func newTestConn(t *testing.T) *jsonrpc2.Conn {
@@ -753,12 +1166,19 @@ func newTestConn(t *testing.T) *jsonrpc2.Conn {
 	return conn
 }
 
-// fakeReporter records what lint runs report. Linters report from several
-// goroutines at once, so it locks.
+// fakeReporter records what lint runs report, and plays a client that applies
+// every edit it is asked to. Linters report from several goroutines at once, so
+// it locks.
 type fakeReporter struct {
 	mu          sync.Mutex
 	diagnostics map[types.DocumentURI][]types.Diagnostic
-	errors      []error
+	// documents an empty set was published for
+	resets []types.DocumentURI
+	errors []error
+	edits  []types.ApplyWorkspaceEditParams
+	// the globs of every registration of file watchers, and nil for every time
+	// one was taken back
+	watchers [][]string
 }
 
 func (r *fakeReporter) PublishDiagnostics(_ context.Context, params types.PublishDiagnosticsParams) {
@@ -766,7 +1186,8 @@ func (r *fakeReporter) PublishDiagnostics(_ context.Context, params types.Publis
 	defer r.mu.Unlock()
 
 	if len(params.Diagnostics) == 0 {
-		// the run's initial reset, not a result
+		// the document cleared, not a result
+		r.resets = append(r.resets, params.URI)
 		return
 	}
 	if r.diagnostics == nil {
@@ -775,6 +1196,59 @@ func (r *fakeReporter) PublishDiagnostics(_ context.Context, params types.Publis
 	r.diagnostics[params.URI] = append(r.diagnostics[params.URI], params.Diagnostics...)
 }
 
+func (r *fakeReporter) ApplyEdit(_ context.Context, params types.ApplyWorkspaceEditParams) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.edits = append(r.edits, params)
+	return nil
+}
+
+func (r *fakeReporter) RegisterCapability(_ context.Context, params types.RegistrationParams) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registration := range params.Registrations {
+		var globs []string
+		for _, watcher := range registration.RegisterOptions.(types.DidChangeWatchedFilesRegistrationOptions).Watchers {
+			globs = append(globs, watcher.GlobPattern)
+		}
+		r.watchers = append(r.watchers, globs)
+	}
+	return nil
+}
+
+func (r *fakeReporter) UnregisterCapability(_ context.Context, params types.UnregistrationParams) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for range params.Unregisterations {
+		r.watchers = append(r.watchers, nil)
+	}
+	return nil
+}
+
+func (r *fakeReporter) registeredWatchers() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.watchers
+}
+
+func (r *fakeReporter) appliedEdits() []types.ApplyWorkspaceEditParams {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.edits
+}
+
+func (r *fakeReporter) resetDocuments() []types.DocumentURI {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.resets
+}
+
 func (r *fakeReporter) Progress(context.Context, types.ProgressParams) {}
 
 func (r *fakeReporter) ReportError(_ context.Context, err error) {
@@ -784,6 +1258,8 @@ func (r *fakeReporter) ReportError(_ context.Context, err error) {
 	r.errors = append(r.errors, err)
 }
 
+func (r *fakeReporter) ReportWarning(context.Context, string) {}
+
 func (r *fakeReporter) diagnosticsFor(uri types.DocumentURI) []types.Diagnostic {
 	r.mu.Lock()
 	defer r.mu.Unlock()
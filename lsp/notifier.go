@@ -1,7 +1,10 @@
 package lsp
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"slices"
 
 	"github.com/sourcegraph/jsonrpc2"
 
@@ -17,10 +20,14 @@ type LspNotifier struct {
 	// Reporting it to a client that did not is a protocol violation, and clients
 	// that notice complain about a token they never agreed to.
 	progress bool
+	// diagnostics says which of the optional parts of a diagnostic the client
+	// takes. The others are left out rather than sent to a client that may choke
+	// on them, or at least show them in ways nobody intended
+	diagnostics types.PublishDiagnosticsClientCapabilities
 }
 
-func NewNotifier(conn *jsonrpc2.Conn, progress bool) *LspNotifier {
-	return &LspNotifier{conn: conn, progress: progress}
+func NewNotifier(conn *jsonrpc2.Conn, progress bool, diagnostics types.PublishDiagnosticsClientCapabilities) *LspNotifier {
+	return &LspNotifier{conn: conn, progress: progress, diagnostics: diagnostics}
 }
 
 func (n *LspNotifier) LogMessage(ctx context.Context, typ types.MessageType, message string) {
@@ -31,9 +38,42 @@ func (n *LspNotifier) LogMessage(ctx context.Context, typ types.MessageType, mes
 }
 
 func (n *LspNotifier) PublishDiagnostics(ctx context.Context, params types.PublishDiagnosticsParams) {
+	params.Diagnostics = supportedDiagnostics(params.Diagnostics, n.diagnostics)
 	n.notify(ctx, "textDocument/publishDiagnostics", &params)
 }
 
+// supportedDiagnostics returns diagnostics with whatever the client does not take
+// left out. The diagnostics are copied rather than changed in place: the server
+// keeps them, and another client may well take what this one does not.
+func supportedDiagnostics(diagnostics []types.Diagnostic, supported types.PublishDiagnosticsClientCapabilities) []types.Diagnostic {
+	out := make([]types.Diagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		if !supported.CodeDescriptionSupport {
+			d.CodeDescription = nil
+		}
+		if !supported.RelatedInformation {
+			d.RelatedInformation = nil
+		}
+		if !supported.DataSupport {
+			d.Data = nil
+		}
+
+		var tags []types.DiagnosticTag
+		if supported.TagSupport != nil {
+			for _, tag := range d.Tags {
+				if slices.Contains(supported.TagSupport.ValueSet, tag) {
+					tags = append(tags, tag)
+				}
+			}
+		}
+		d.Tags = tags
+
+		out = append(out, d)
+	}
+
+	return out
+}
+
 func (n *LspNotifier) Progress(ctx context.Context, params types.ProgressParams) {
 	if !n.progress {
 		return
@@ -46,6 +86,37 @@ func (n *LspNotifier) ReportError(ctx context.Context, err error) {
 	n.LogMessage(ctx, types.MessError, err.Error())
 }
 
+func (n *LspNotifier) ReportWarning(ctx context.Context, message string) {
+	n.LogMessage(ctx, types.MessWarning, message)
+}
+
+// ApplyEdit asks the client to apply edit. Unlike everything else here it waits
+// for the client's answer, so it must not be called on the connection's read
+// loop: that is what would have to deliver the answer.
+func (n *LspNotifier) ApplyEdit(ctx context.Context, params types.ApplyWorkspaceEditParams) error {
+	var result types.ApplyWorkspaceEditResult
+	if err := n.conn.Call(ctx, "workspace/applyEdit", &params, &result); err != nil {
+		return err
+	}
+	if !result.Applied {
+		return fmt.Errorf("the client did not apply the edit: %s", cmp.Or(result.FailureReason, "no reason given"))
+	}
+
+	return nil
+}
+
+// RegisterCapability asks the client to start sending what params registers
+// for. Like ApplyEdit it waits for the client's answer.
+func (n *LspNotifier) RegisterCapability(ctx context.Context, params types.RegistrationParams) error {
+	return n.conn.Call(ctx, "client/registerCapability", &params, nil)
+}
+
+// UnregisterCapability takes back what RegisterCapability registered. Like
+// ApplyEdit it waits for the client's answer.
+func (n *LspNotifier) UnregisterCapability(ctx context.Context, params types.UnregistrationParams) error {
+	return n.conn.Call(ctx, "client/unregisterCapability", &params, nil)
+}
+
 // notify is best-effort: a cancelled run or a closed connection makes the send
 // fail, and there is nothing to be done about it but leave a trace in the log.
 func (n *LspNotifier) notify(ctx context.Context, method string, params any) {
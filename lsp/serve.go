@@ -0,0 +1,108 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/konradmalik/flint-ls/core"
+	"github.com/konradmalik/flint-ls/logs"
+)
+
+// ServeConn serves one client over rwc until the connection goes away or ctx is
+// done, and returns the exit code the client asked for. Every client gets a
+// handler of its own: documents, configuration and tool daemons are all the
+// business of the editor that opened them.
+func ServeConn(ctx context.Context, rwc io.ReadWriteCloser) int {
+	// the languages arrive later, in a didChangeConfiguration notification
+	handler := NewHandler(core.NewHandler(nil))
+
+	conn := jsonrpc2.NewConn(
+		ctx,
+		jsonrpc2.NewBufferedStream(rwc, jsonrpc2.VSCodeObjectCodec{}),
+		OffloadSlowRequests(jsonrpc2.HandlerWithError(handler.Handle)),
+		jsonrpc2.LogMessages(logs.Log))
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	<-conn.DisconnectNotify()
+
+	// the client is gone: abandon anything still scheduled instead of letting
+	// pending linters run against a dead connection
+	handler.Close()
+	return handler.ExitCode()
+}
+
+// Serve accepts clients on l until it is closed, serving each on a goroutine of
+// its own, and waits for the connections it accepted to end before returning.
+// Closing the listener is the way to stop it; cancelling ctx as well ends the
+// connections still open.
+func Serve(ctx context.Context, l net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		logs.Log.Logf(logs.Info, "client connected from %s", conn.RemoteAddr())
+		wg.Go(func() {
+			ServeConn(ctx, conn)
+			logs.Log.Logf(logs.Info, "client from %s disconnected", conn.RemoteAddr())
+		})
+	}
+}
+
+// Listen opens the listener an address given as network:address names:
+// tcp:127.0.0.1:7777 or unix:/run/user/1000/flint.sock.
+func Listen(address string) (net.Listener, error) {
+	network, addr, ok := strings.Cut(address, ":")
+	if !ok || addr == "" {
+		return nil, fmt.Errorf("invalid listen address %q, expected network:address", address)
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return net.Listen(network, addr)
+	case "unix":
+		removeStaleSocket(addr)
+		return net.Listen(network, addr)
+	case "pipe":
+		// Windows named pipes need the win32 pipe API, which the standard library
+		// does not expose; Windows 10 and later speak unix sockets instead
+		return nil, fmt.Errorf("named pipes are not supported, use a unix socket: unix:%s", addr)
+	default:
+		return nil, fmt.Errorf("unsupported network %q in listen address %q", network, address)
+	}
+}
+
+// removeStaleSocket removes a socket file that a server which did not shut down
+// cleanly left behind, which would otherwise keep every later one from
+// listening. A socket something still answers on is left alone, so that
+// listening fails rather than stealing the address from a live server.
+func removeStaleSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode().Type() != os.ModeSocket {
+		return
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return
+	}
+
+	logs.Log.Logf(logs.Info, "removing stale socket %s", path)
+	_ = os.Remove(path)
+}
@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/konradmalik/flint-ls/types"
+)
+
+func TestServeGivesEveryClientItsOwnSession(t *testing.T) {
+	l, err := Listen("tcp:127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, l) }()
+
+	first := dialTestClient(t, l.Addr())
+	second := dialTestClient(t, l.Addr())
+
+	for _, client := range []*jsonrpc2.Conn{first, second} {
+		var result types.InitializeResult
+		require.NoError(t, client.Call(ctx, "initialize", types.InitializeParams{}, &result))
+	}
+
+	// one editor quitting ends its own session and nothing else
+	require.NoError(t, first.Call(ctx, "shutdown", nil, nil))
+	require.NoError(t, first.Notify(ctx, "exit", nil))
+	waitDisconnected(t, first)
+
+	var result types.InitializeResult
+	require.NoError(t, second.Call(ctx, "initialize", types.InitializeParams{}, &result),
+		"the other client lost its session along with the first")
+
+	// closing the listener stops new clients, cancelling ends the open sessions
+	require.NoError(t, l.Close())
+	cancel()
+
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Serve did not return once its listener was closed")
+	}
+	waitDisconnected(t, second)
+}
+
+func TestListen(t *testing.T) {
+	for _, address := range []string{"7777", "tcp:", "udp:127.0.0.1:7777", "pipe:flint"} {
+		t.Run(address, func(t *testing.T) {
+			_, err := Listen(address)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestListenReplacesAStaleSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("a socket file left behind is a unix affair")
+	}
+
+	path := filepath.Join(t.TempDir(), "flint.sock")
+
+	live, err := Listen("unix:" + path)
+	require.NoError(t, err)
+
+	_, err = Listen("unix:" + path)
+	require.Error(t, err, "a socket a server still answers on must not be taken over")
+
+	// what a server that was killed leaves behind
+	live.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, live.Close())
+
+	l, err := Listen("unix:" + path)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+}
+
+func dialTestClient(t *testing.T, addr net.Addr) *jsonrpc2.Conn {
+	t.Helper()
+
+	nc, err := net.Dial(addr.Network(), addr.String())
+	require.NoError(t, err)
+
+	// the server's notifications are of no interest here
+	ignore := jsonrpc2.HandlerWithError(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) (any, error) {
+		return nil, nil
+	})
+	conn := jsonrpc2.NewConn(t.Context(), jsonrpc2.NewBufferedStream(nc, jsonrpc2.VSCodeObjectCodec{}), ignore)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func waitDisconnected(t *testing.T, conn *jsonrpc2.Conn) {
+	t.Helper()
+
+	select {
+	case <-conn.DisconnectNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the server never closed the connection")
+	}
+}
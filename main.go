@@ -4,11 +4,13 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
-	"github.com/sourcegraph/jsonrpc2"
-
+	"github.com/konradmalik/flint-ls/cli"
 	"github.com/konradmalik/flint-ls/core"
 	"github.com/konradmalik/flint-ls/logs"
 	"github.com/konradmalik/flint-ls/lsp"
@@ -21,16 +23,52 @@ const (
 
 var revision = "HEAD"
 
+// subcommands run the language configuration from the command line instead of
+// serving an editor.
+var subcommands = []struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string, stdout, stderr io.Writer) int
+}{
+	{"lint", "lint files with their configured linters and print what they found", cli.Lint},
+	{"format", "format files with their configured formatters, or check that they are", cli.Format},
+	{"doctor", "explain which configs apply to a file and dry run their tools", cli.Doctor},
+}
+
 func main() {
+	// run as the limits shim, this becomes the tool it was started for
+	core.ExecLimited()
+
+	for _, sub := range subcommands {
+		if len(os.Args) > 1 && os.Args[1] == sub.name {
+			// interrupted, the tools still running are killed rather than left behind
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			code := sub.run(ctx, os.Args[2:], os.Stdout, os.Stderr)
+			stop()
+			os.Exit(code)
+		}
+	}
+
 	var logfile string
 	var loglevel int
 	var showVersion bool
 	var usage bool
+	var listen string
 
 	flag.StringVar(&logfile, "logfile", "", "File to save logs into. If provided stderr won't be used anymore.")
 	flag.IntVar(&loglevel, "loglevel", 2, "Set the log level. Max is 3 (debug), min is 0 (error). Higher number logs less. Set <0 for no logs.")
 	flag.BoolVar(&showVersion, "v", false, "Print the version")
 	flag.BoolVar(&usage, "h", false, "Show help")
+	flag.StringVar(&listen, "listen", "", "Serve clients connecting to this address instead of stdio: tcp:host:port or unix:/path/to/socket")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage of %s:\n", name)
+		flag.PrintDefaults()
+		fmt.Fprintf(out, "\nSubcommands, each with its own -h:\n")
+		for _, sub := range subcommands {
+			fmt.Fprintf(out, "  %-8s%s\n", sub.name, sub.summary)
+		}
+	}
 	flag.Parse()
 
 	if showVersion {
@@ -44,23 +82,40 @@ func main() {
 	}
 
 	logs.InitializeLogger(logfile, logs.LogLevel(min(max(loglevel, int(logs.None)), int(logs.Debug))))
+
+	if listen != "" {
+		os.Exit(serve(listen))
+	}
+
 	logs.Log.Logln(logs.Info, "reading on stdin, writing on stdout")
+	exitCode := lsp.ServeConn(context.Background(), stdrwc{})
+	logs.Log.Logln(logs.Info, "flint-ls: connections closed")
+	os.Exit(exitCode)
+}
 
-	// the languages arrive later, in a didChangeConfiguration notification
-	handler := lsp.NewHandler(core.NewHandler(nil))
+// serve accepts clients on address until the process is told to stop. A client
+// asking to exit ends its own connection, not the server.
+func serve(address string) int {
+	l, err := lsp.Listen(address)
+	if err != nil {
+		// said on stderr whatever the log level: nothing has started yet, and the
+		// one reading it is whoever ran the command
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	logs.Log.Logf(logs.Info, "listening on %s", l.Addr())
 
-	<-jsonrpc2.NewConn(
-		context.Background(),
-		jsonrpc2.NewBufferedStream(stdrwc{}, jsonrpc2.VSCodeObjectCodec{}),
-		lsp.OffloadSlowRequests(jsonrpc2.HandlerWithError(handler.Handle)),
-		jsonrpc2.LogMessages(logs.Log)).DisconnectNotify()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() { _ = l.Close() })
 
-	logs.Log.Logln(logs.Info, "flint-ls: connections closed")
+	if err := lsp.Serve(ctx, l); err != nil {
+		logs.Log.Logln(logs.Error, err.Error())
+		return 1
+	}
 
-	// the client is gone: abandon anything still scheduled instead of letting
-	// pending linters run against a dead connection
-	handler.Close()
-	os.Exit(handler.ExitCode())
+	logs.Log.Logln(logs.Info, "flint-ls: stopped listening")
+	return 0
 }
 
 type stdrwc struct{}
@@ -10,6 +10,34 @@ type Config struct {
 	Languages map[string][]Language `json:"languages,omitempty"`
 	// how long a document must be idle before it is linted
 	LintDebounce time.Duration `json:"lintDebounce,omitempty"`
+	// how long a tool daemon may go unused before it is stopped
+	DaemonIdleTimeout time.Duration `json:"daemonIdleTimeout,omitempty"`
+	// globs of the documents no linter runs on, relative to the workspace root.
+	// nil means the client said nothing about them
+	LintExclude []string `json:"lintExclude,omitempty"`
+	// the least severe diagnostics published; those less severe are dropped.
+	// nil means the client said nothing about it, 0 that every one is published
+	MinSeverity *DiagnosticSeverity `json:"minSeverity,omitempty"`
+	// how many diagnostics a document gets at most, the most severe first. nil
+	// means the client said nothing about it, 0 that there is no limit
+	MaxDiagnostics *int `json:"maxDiagnostics,omitempty"`
+	// publish a finding two linters report once: those at the same range with
+	// the same message, or the same code, are taken for one. nil means the client
+	// said nothing about it
+	DeduplicateDiagnostics *bool `json:"deduplicateDiagnostics,omitempty"`
+	// the sources whose diagnostic is kept of those taken for one, the preferred
+	// first. A source not listed comes after all that are
+	SourcePrecedence []string `json:"sourcePrecedence,omitempty"`
+	// codes that stand for the same finding as another code, each mapped to that
+	// code, as a type checker's number to a linter's rule name
+	DuplicateCodes map[string]string `json:"duplicateCodes,omitempty"`
+}
+
+// ChangesDiagnostics reports whether the config says anything that changes the
+// diagnostics of the documents already linted.
+func (c Config) ChangesDiagnostics() bool {
+	return c.Languages != nil || c.LintExclude != nil || c.MinSeverity != nil || c.MaxDiagnostics != nil ||
+		c.DeduplicateDiagnostics != nil || c.SourcePrecedence != nil || c.DuplicateCodes != nil
 }
 
 type Language struct {
@@ -29,16 +57,180 @@ type Language struct {
 	LintCategoryMap    map[string]string  `json:"lintCategoryMap,omitempty"`
 	LintSource         string             `json:"lintSource,omitempty"`
 	LintSeverity       DiagnosticSeverity `json:"lintSeverity,omitempty"`
+	// a regular expression finding a finding's code in its message: what its
+	// first group captures, or all of it if it has none. The match is taken out of
+	// the message
+	LintCodePattern string `json:"lintCodePattern,omitempty"`
+	// where a finding's code is documented, with ${CODE} standing for the code
+	LintCodeURLTemplate string `json:"lintCodeUrlTemplate,omitempty"`
+	// regular expressions for the codes of findings about code that is not
+	// needed, an unused import say. Each has to match a whole code
+	LintUnnecessaryCodes []string `json:"lintUnnecessaryCodes,omitempty"`
+	// regular expressions for the codes of findings about code that is
+	// deprecated. Each has to match a whole code
+	LintDeprecatedCodes []string `json:"lintDeprecatedCodes,omitempty"`
+	// change the severity of findings, or drop them. The first rule that matches
+	// a finding decides for it
+	LintSeverityRules []SeverityRule `json:"lintSeverityRules,omitempty"`
+	// attach the notes the linter prints after a finding, the entries of type n,
+	// to that finding instead of reporting each as one of its own. So too the
+	// continuation lines of a multi-line finding that point somewhere else
+	LintNotesAsRelated bool `json:"lintNotesAsRelated,omitempty"`
+	// publish what the linter finds in other open documents, a package linter's
+	// findings in the other files of the package say, as their diagnostics
+	// instead of dropping it
+	LintReportOtherFiles bool `json:"lintReportOtherFiles,omitempty"`
+	// publish only the findings on the lines that differ from what the document
+	// is at LintBaseRef in the git repository of its root, so that a legacy file
+	// shows what an edit broke and not everything it always had
+	LintChangedLinesOnly bool `json:"lintChangedLinesOnly,omitempty"`
+	// the commit, branch or tag LintChangedLinesOnly compares with. Defaults to
+	// HEAD
+	LintBaseRef string `json:"lintBaseRef,omitempty"`
+	// the linter as a list of arguments, run directly rather than through a
+	// shell. Used instead of LintCommand when set
+	LintArgs []string `json:"lintArgs,omitempty"`
+	// which of the linter's output streams hold its findings. Defaults to
+	// OutputStreamBoth
+	LintOutputStream OutputStream `json:"lintOutputStream,omitempty"`
+	// how far the range of a finding the linter gives no end for reaches.
+	// Defaults to RangeModeWord
+	LintRangeMode RangeMode `json:"lintRangeMode,omitempty"`
+	// a regular expression matching one character of a symbol, for
+	// RangeModeSymbol. Defaults to letters, digits, _ and $
+	LintSymbolPattern string `json:"lintSymbolPattern,omitempty"`
+	// keep the linter running between runs and send it documents over its
+	// stdin instead of starting it for every run
+	LintDaemon bool `json:"lintDaemon,omitempty"`
 	// defaults to true if not provided as a sanity default
 	LintAfterOpen *bool `json:"lintAfterOpen,omitempty"`
 	// defaults to true if not provided as a sanity default
 	LintOnChange *bool `json:"lintOnChange,omitempty"`
 	// defaults to true if not provided as a sanity default
-	LintOnSave     *bool  `json:"lintOnSave,omitempty"`
-	FormatCommand  string `json:"formatCommand,omitempty"`
-	FormatCanRange bool   `json:"formatCanRange,omitempty"`
+	LintOnSave *bool `json:"lintOnSave,omitempty"`
+	// globs of the files the linter reads its own configuration from, relative to
+	// the root it runs in. A change to one of them lints the documents under that
+	// root again. A glob without a slash matches a file of that name in any
+	// directory, and ** matches any number of directories
+	LintWatchFiles []string `json:"lintWatchFiles,omitempty"`
+	// globs of the documents the linter does not run on, relative to the
+	// workspace root, as the top level lintExclude. The config's formatter still
+	// runs on them
+	LintExclude    []string `json:"lintExclude,omitempty"`
+	FormatCommand  string   `json:"formatCommand,omitempty"`
+	FormatCanRange bool     `json:"formatCanRange,omitempty"`
+	// the formatter as a list of arguments, run directly rather than through a
+	// shell. Used instead of FormatCommand when set
+	FormatArgs []string `json:"formatArgs,omitempty"`
+	// keep the formatter running between runs and send it documents over its
+	// stdin instead of starting it for every run
+	FormatDaemon bool `json:"formatDaemon,omitempty"`
+	// how the formatters of a language combine; the first formatter that sets
+	// this decides for all of them. Defaults to FormatModeChain
+	FormatMode FormatMode `json:"formatMode,omitempty"`
+	// characters that make the client ask for formatting while the user types.
+	// Meant for formatters fast enough to keep up, and a formatter that can
+	// format a range is only asked for the lines around the cursor
+	FormatOnTypeTriggers []string `json:"formatOnTypeTriggers,omitempty"`
+	// format only the lines that differ from what the document is at
+	// FormatBaseRef in the git repository of its root, so that formatting a legacy
+	// file changes what the edit at hand changed and nothing else. A formatter
+	// that can format a range is asked for each run of changed lines; the edits
+	// any other one makes elsewhere are dropped. Requests for a range are left as
+	// they are
+	FormatChangedLinesOnly bool `json:"formatChangedLinesOnly,omitempty"`
+	// the commit, branch or tag FormatChangedLinesOnly compares with. Defaults to
+	// HEAD
+	FormatBaseRef string `json:"formatBaseRef,omitempty"`
+	// names of the environment variables the tools inherit from flint-ls, where a
+	// trailing * matches a prefix. nil inherits everything and an empty list
+	// nothing; Env is added either way
+	EnvAllowlist []string `json:"envAllowlist,omitempty"`
+	// resources the tools may use
+	Limits Limits `json:"limits"`
+}
+
+// SeverityRule matches a linter's findings and sets their severity, or drops
+// them. A finding has to match every matcher the rule sets, so a rule that sets
+// none matches them all.
+type SeverityRule struct {
+	// a regular expression that has to match the whole code
+	Code string `json:"code,omitempty"`
+	// a regular expression that has to match somewhere in the message
+	Message string `json:"message,omitempty"`
+	// a regular expression that has to match the whole source
+	Source string `json:"source,omitempty"`
+	// the severity the findings get
+	Severity DiagnosticSeverity `json:"severity,omitempty"`
+	// drop the findings instead
+	Suppress bool `json:"suppress,omitempty"`
+}
+
+// Limits bounds what a tool may do to the machine it runs on. A zero value is no
+// limit. Everything but MaxOutputBytes is only enforced on Linux.
+type Limits struct {
+	// address space, in bytes. Runtimes that reserve far more than they use, like
+	// Go's or the JVM's, need this set well above their actual footprint
+	MemoryBytes uint64 `json:"memoryBytes,omitempty"`
+	// CPU time, in seconds
+	CPUSeconds uint64 `json:"cpuSeconds,omitempty"`
+	// niceness, as for nice(1). Only root can go below zero
+	Nice int `json:"nice,omitempty"`
+	// I/O scheduling class, as for ionice(1): "idle", "best-effort" or "realtime"
+	IOClass string `json:"ioClass,omitempty"`
+	// priority within IOClass, from 0 (highest) to 7
+	IOPriority int `json:"ioPriority,omitempty"`
+	// how much a tool may print before it is killed
+	MaxOutputBytes int64 `json:"maxOutputBytes,omitempty"`
 }
 
+// FormatMode decides what a run does with the formatters configured for a
+// document when there is more than one of them, or when one of them fails.
+type FormatMode string
+
+const (
+	// FormatModeChain runs every formatter, each fed the previous one's output,
+	// and skips the ones that fail.
+	FormatModeChain FormatMode = "chain"
+	// FormatModeFirst stops at the first formatter that succeeds, which is what a
+	// fast formatter backed by a slower fallback (prettierd, then prettier) wants.
+	FormatModeFirst FormatMode = "first"
+	// FormatModeStrict runs every formatter like FormatModeChain, but gives up on
+	// the whole run when any of them fails instead of returning a document that
+	// only some of them have seen.
+	FormatModeStrict FormatMode = "strict"
+)
+
+// OutputStream names the output streams of a tool that are worth reading.
+type OutputStream string
+
+const (
+	OutputStreamStdout OutputStream = "stdout"
+	OutputStreamStderr OutputStream = "stderr"
+	// OutputStreamBoth reads both, merged line by line.
+	OutputStreamBoth OutputStream = "both"
+)
+
+// RangeMode says how far the range of a finding reaches when the linter reports
+// where it starts and not where it ends.
+type RangeMode string
+
+const (
+	// RangeModeWord reaches the end of the token the finding starts at: a run of
+	// letters and digits, or one of punctuation.
+	RangeModeWord RangeMode = "word"
+	// RangeModeLine reaches the end of the line, short of its trailing blanks. A
+	// finding without a column covers all of the line.
+	RangeModeLine RangeMode = "line"
+	// RangeModePoint reaches nowhere: the range is empty.
+	RangeModePoint RangeMode = "point"
+	// RangeModeSymbol reaches the end of the run of characters matching the
+	// config's LintSymbolPattern.
+	RangeModeSymbol RangeMode = "symbol"
+	// RangeModeUntilWhitespace reaches the first blank.
+	RangeModeUntilWhitespace RangeMode = "untilWhitespace"
+)
+
 // EventType is a set of the document events a lint run covers. It is a set
 // because a run can be asked to cover the events of a run it replaces: a
 // scheduled run that a later notification supersedes would otherwise take the
@@ -49,4 +241,19 @@ const (
 	EventTypeChange EventType = 1 << iota
 	EventTypeSave
 	EventTypeOpen
+	// EventTypeCommand is a run somebody asked for, which every linter takes part
+	// in whatever events it is set to run on
+	EventTypeCommand
 )
+
+// HasLinter reports whether the config runs a linter, in either of the ways one
+// can be configured.
+func (l Language) HasLinter() bool {
+	return l.LintCommand != "" || len(l.LintArgs) > 0
+}
+
+// HasFormatter reports whether the config runs a formatter, in either of the
+// ways one can be configured.
+func (l Language) HasFormatter() bool {
+	return l.FormatCommand != "" || len(l.FormatArgs) > 0
+}
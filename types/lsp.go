@@ -1,7 +1,9 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"sync/atomic"
 )
 
@@ -16,10 +18,42 @@ type InitializeParams struct {
 type InitializeOptions struct {
 	DocumentFormatting bool `json:"documentFormatting"`
 	RangeFormatting    bool `json:"documentRangeFormatting"`
+	// trigger characters to announce for on-type formatting, for configurations
+	// that only arrive after initialize
+	OnTypeFormattingTriggers []string `json:"documentOnTypeFormattingTriggers"`
 }
 
 type ClientCapabilities struct {
-	Window WindowClientCapabilities `json:"window"`
+	TextDocument TextDocumentClientCapabilities `json:"textDocument"`
+	Workspace    WorkspaceClientCapabilities    `json:"workspace"`
+	Window       WindowClientCapabilities       `json:"window"`
+}
+
+type TextDocumentClientCapabilities struct {
+	PublishDiagnostics PublishDiagnosticsClientCapabilities `json:"publishDiagnostics"`
+}
+
+// PublishDiagnosticsClientCapabilities says which of the optional parts of a
+// diagnostic the client does something with. It is sent none of the others.
+type PublishDiagnosticsClientCapabilities struct {
+	RelatedInformation     bool                  `json:"relatedInformation"`
+	TagSupport             *DiagnosticTagSupport `json:"tagSupport,omitempty"`
+	CodeDescriptionSupport bool                  `json:"codeDescriptionSupport"`
+	DataSupport            bool                  `json:"dataSupport"`
+}
+
+type DiagnosticTagSupport struct {
+	ValueSet []DiagnosticTag `json:"valueSet"`
+}
+
+type WorkspaceClientCapabilities struct {
+	DidChangeWatchedFiles DidChangeWatchedFilesClientCapabilities `json:"didChangeWatchedFiles"`
+}
+
+type DidChangeWatchedFilesClientCapabilities struct {
+	// whether the server may ask the client to watch files, which is the only
+	// way it gets to say which ones
+	DynamicRegistration bool `json:"dynamicRegistration"`
 }
 
 type WindowClientCapabilities struct {
@@ -69,6 +103,18 @@ type ServerCapabilities struct {
 	TextDocumentSync           TextDocumentSyncOptions `json:"textDocumentSync"`
 	DocumentFormattingProvider bool                    `json:"documentFormattingProvider,omitempty"`
 	RangeFormattingProvider    bool                    `json:"documentRangeFormattingProvider,omitempty"`
+	// nil when no formatter asked to run while typing
+	OnTypeFormattingProvider *DocumentOnTypeFormattingOptions `json:"documentOnTypeFormattingProvider,omitempty"`
+	ExecuteCommandProvider   *ExecuteCommandOptions           `json:"executeCommandProvider,omitempty"`
+}
+
+type ExecuteCommandOptions struct {
+	Commands []string `json:"commands"`
+}
+
+type DocumentOnTypeFormattingOptions struct {
+	FirstTriggerCharacter string   `json:"firstTriggerCharacter"`
+	MoreTriggerCharacter  []string `json:"moreTriggerCharacter,omitempty"`
 }
 
 type TextDocumentItem struct {
@@ -131,11 +177,92 @@ const (
 )
 
 type Diagnostic struct {
-	Range    Range              `json:"range"`
-	Severity DiagnosticSeverity `json:"severity,omitempty"`
-	Code     *int               `json:"code,omitempty"`
-	Source   *string            `json:"source,omitempty"`
-	Message  string             `json:"message"`
+	Range              Range                          `json:"range"`
+	Severity           DiagnosticSeverity             `json:"severity,omitempty"`
+	Code               *DiagnosticCode                `json:"code,omitempty"`
+	CodeDescription    *CodeDescription               `json:"codeDescription,omitempty"`
+	Source             *string                        `json:"source,omitempty"`
+	Message            string                         `json:"message"`
+	Tags               []DiagnosticTag                `json:"tags,omitempty"`
+	RelatedInformation []DiagnosticRelatedInformation `json:"relatedInformation,omitempty"`
+	// kept by the client and handed back with the diagnostic, in a code action
+	// request say
+	Data any `json:"data,omitempty"`
+}
+
+// DiagnosticCode is the code of a diagnostic, which the protocol lets be a
+// number or a string. A code that came as a number goes out as one, so a client
+// sees the same codes it always has from linters that report numbers.
+type DiagnosticCode struct {
+	text string
+	// number says that text spells a number, which is what goes on the wire
+	number bool
+}
+
+// IntCode is a code that is a number.
+func IntCode(n int) *DiagnosticCode {
+	return &DiagnosticCode{text: strconv.Itoa(n), number: true}
+}
+
+// StringCode is a code that is a string, even one that looks like a number.
+func StringCode(s string) *DiagnosticCode {
+	return &DiagnosticCode{text: s}
+}
+
+func (c DiagnosticCode) String() string {
+	return c.text
+}
+
+func (c DiagnosticCode) MarshalJSON() ([]byte, error) {
+	if c.number {
+		return []byte(c.text), nil
+	}
+	return json.Marshal(c.text)
+}
+
+func (c *DiagnosticCode) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*c = *IntCode(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("a diagnostic code is a number or a string: %w", err)
+	}
+	*c = *StringCode(s)
+	return nil
+}
+
+type CodeDescription struct {
+	Href string `json:"href"`
+}
+
+type DiagnosticTag int
+
+const (
+	// DiagUnnecessary marks code that is not needed, which a client may fade out.
+	DiagUnnecessary DiagnosticTag = iota + 1
+	// DiagDeprecated marks code that is deprecated, which a client may strike
+	// through.
+	DiagDeprecated
+)
+
+type Location struct {
+	URI   DocumentURI `json:"uri"`
+	Range Range       `json:"range"`
+}
+
+type DiagnosticRelatedInformation struct {
+	Location Location `json:"location"`
+	Message  string   `json:"message"`
+}
+
+// LintData is the data of a diagnostic a linter found.
+type LintData struct {
+	// what the linter printed about the finding, as it printed it
+	Output []string `json:"output,omitempty"`
 }
 
 type PublishDiagnosticsParams struct {
@@ -195,6 +322,14 @@ type DocumentRangeFormattingParams struct {
 	Options      FormattingOptions      `json:"options"`
 }
 
+type DocumentOnTypeFormattingParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	// where the cursor is after ch was typed
+	Position Position          `json:"position"`
+	Ch       string            `json:"ch"`
+	Options  FormattingOptions `json:"options"`
+}
+
 type TextEdit struct {
 	Range   Range  `json:"range"`
 	NewText string `json:"newText"`
@@ -208,3 +343,69 @@ type LogMessageParams struct {
 	Type    MessageType `json:"type"`
 	Message string      `json:"message"`
 }
+
+type ExecuteCommandParams struct {
+	Command string `json:"command"`
+	// left raw, since what they hold is up to each command
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+type WorkspaceEdit struct {
+	Changes map[DocumentURI][]TextEdit `json:"changes"`
+}
+
+type ApplyWorkspaceEditParams struct {
+	// what the client may show the user, in an undo menu say
+	Label string        `json:"label,omitempty"`
+	Edit  WorkspaceEdit `json:"edit"`
+}
+
+type ApplyWorkspaceEditResult struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+type Registration struct {
+	ID              string `json:"id"`
+	Method          string `json:"method"`
+	RegisterOptions any    `json:"registerOptions,omitempty"`
+}
+
+type RegistrationParams struct {
+	Registrations []Registration `json:"registrations"`
+}
+
+type Unregistration struct {
+	ID     string `json:"id"`
+	Method string `json:"method"`
+}
+
+type UnregistrationParams struct {
+	// misspelled in the specification, and so on the wire
+	Unregisterations []Unregistration `json:"unregisterations"`
+}
+
+type DidChangeWatchedFilesRegistrationOptions struct {
+	Watchers []FileSystemWatcher `json:"watchers"`
+}
+
+type FileSystemWatcher struct {
+	GlobPattern string `json:"globPattern"`
+}
+
+type FileChangeType int
+
+const (
+	FileCreated FileChangeType = 1
+	FileChanged FileChangeType = 2
+	FileDeleted FileChangeType = 3
+)
+
+type FileEvent struct {
+	URI  DocumentURI    `json:"uri"`
+	Type FileChangeType `json:"type"`
+}
+
+type DidChangeWatchedFilesParams struct {
+	Changes []FileEvent `json:"changes"`
+}
@@ -0,0 +1,36 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticCodeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		code *DiagnosticCode
+		json string
+	}{
+		{"a number", IntCode(501), `501`},
+		{"a string", StringCode("E501"), `"E501"`},
+		{"a string that looks like a number", StringCode("0042"), `"0042"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(Diagnostic{Code: tt.code})
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"code":`+tt.json+`,"message":""}`, string(data))
+
+			var back Diagnostic
+			require.NoError(t, json.Unmarshal(data, &back))
+			assert.Equal(t, tt.code, back.Code)
+		})
+	}
+
+	var code DiagnosticCode
+	assert.Error(t, json.Unmarshal([]byte(`{}`), &code))
+}